@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kopi22/chip8/assembler"
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/octo"
+	"github.com/kopi22/chip8/symbols"
+)
+
+func main() {
+	output := flag.String("o", "", "ROM to write, by default the source file name with a .ch8 extension")
+	symbolFile := flag.String("sym", "", "symbol map to write, by default the ROM name with a .sym extension")
+	noSymbols := flag.Bool("nosym", false, "do not write a symbol map")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: asm [flags] source.s|source.8o\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	source := flag.Arg(0)
+
+	rom, syms, err := build(source)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	romFilename := *output
+	if romFilename == "" {
+		romFilename = strings.TrimSuffix(source, filepath.Ext(source)) + ".ch8"
+	}
+	if err := ioutil.WriteFile(romFilename, rom, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *noSymbols {
+		return
+	}
+	symFilename := *symbolFile
+	if symFilename == "" {
+		symFilename = strings.TrimSuffix(romFilename, filepath.Ext(romFilename)) + emulator.SymbolsExtension
+	}
+	if err := syms.WriteFile(symFilename); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// build assembles source, or compiles it if it is Octo source.
+func build(source string) ([]byte, *symbols.Map, error) {
+	if filepath.Ext(source) != emulator.OctoExtension {
+		program, err := assembler.AssembleFile(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		return program.Rom, program.Symbols, nil
+	}
+
+	text, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	program, err := octo.Compile(source, string(text))
+	if err != nil {
+		return nil, nil, err
+	}
+	return program.Rom, program.Symbols, nil
+}
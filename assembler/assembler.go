@@ -0,0 +1,526 @@
+// Package assembler turns CHIP-8 assembly, written with the mnemonics the
+// disassembler prints, into a ROM and a symbol map.
+//
+// A line holds an optional label, then an instruction or a directive, then an
+// optional comment starting with ';':
+//
+//	loop:   LD   V0, K        ; wait for a key
+//	        DRW  V1, V2, 5
+//	        JP   loop
+//
+// Directives:
+//
+//	NAME EQU expr            constant, also written NAME = expr
+//	DB   expr, "text", ...   bytes
+//	DW   expr, ...           big-endian words
+//	ORG  expr                continue at an address, filling the gap with zeros
+//	INCLUDE "file"           assemble another file in place
+//	MACRO name a, b ... ENDM macro with parameters, used like an instruction
+//
+// Expressions combine numbers ($hex, 0xhex, %binary, 0bbinary or decimal),
+// labels and constants with + - * / & | and parentheses. Register names and
+// I, DT, ST, K, F, B, HF and R are reserved.
+//
+// LD I with an address above $FFF takes the 4 byte XO-CHIP form F000 nnnn.
+package assembler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/symbols"
+)
+
+const (
+	memorySize   = 0x1000
+	maxNesting   = 16
+	maxErrors    = 50
+	startAddress = emulator.INITIAL_PC
+)
+
+// Error is a problem found at a position of a source file.
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+// ErrorList is returned when assembly fails, in source order.
+type ErrorList []*Error
+
+func (list ErrorList) Error() string {
+	msgs := make([]string, len(list))
+	for i, err := range list {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Program is an assembled ROM, to be loaded at 0x200.
+type Program struct {
+	Rom     []byte
+	Symbols *symbols.Map
+}
+
+type position struct {
+	file string
+	line int
+}
+
+type sourceLine struct {
+	pos    position
+	tokens []token
+}
+
+type macro struct {
+	pos    position
+	params []string
+	body   []sourceLine
+}
+
+type constant struct {
+	pos        position
+	expr       []token
+	value      int
+	evaluating bool
+	done       bool
+}
+
+// statement is an instruction, directive or label to lay out. Code expanded
+// from a macro has the pos of the macro body, for errors, and the source of
+// the line using the macro, for the symbol map.
+type statement struct {
+	pos     position
+	source  position
+	label   *token
+	op      token
+	args    [][]token
+	address uint16
+	long    bool
+}
+
+type assembler struct {
+	statements []*statement
+	constants  map[string]*constant
+	labels     map[string]uint16
+	macros     map[string]*macro
+	defining   *macro
+	defineName string
+	includes   []string
+	expanding  int
+	invocation position
+	errors     ErrorList
+}
+
+// AssembleFile assembles the named file. Included files are looked up
+// relative to the file including them.
+func AssembleFile(filename string) (*Program, error) {
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(filename, source)
+}
+
+// Assemble assembles source, using filename in error messages and to find
+// included files.
+func Assemble(filename string, source []byte) (*Program, error) {
+	a := &assembler{
+		constants: make(map[string]*constant),
+		labels:    make(map[string]uint16),
+		macros:    make(map[string]*macro),
+	}
+
+	var rom []byte
+	a.readSource(filename, source)
+	if len(a.errors) == 0 && a.layout() {
+		rom = a.encode()
+	}
+	if len(a.errors) > 0 {
+		return nil, a.errors
+	}
+
+	return &Program{Rom: rom, Symbols: a.symbols()}, nil
+}
+
+func (a *assembler) errorf(pos position, col int, format string, args ...interface{}) {
+	if len(a.errors) == maxErrors {
+		return
+	}
+	a.errors = append(a.errors, &Error{File: pos.file, Line: pos.line, Column: col, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (a *assembler) readSource(filename string, source []byte) {
+	a.includes = append(a.includes, filename)
+	defer func() { a.includes = a.includes[:len(a.includes)-1] }()
+
+	for i, text := range strings.Split(string(source), "\n") {
+		pos := position{file: filename, line: i + 1}
+		tokens, err := tokenize(text)
+		if err != nil {
+			a.errorf(pos, err.Column, "%s", err.Msg)
+			continue
+		}
+		a.line(pos, tokens)
+	}
+
+	if a.defining != nil && len(a.includes) == 1 {
+		a.errorf(a.defining.pos, 1, "MACRO %s has no ENDM", a.defineName)
+		a.defining = nil
+	}
+}
+
+// line handles one tokenized line of the first pass: it records macros and
+// constants, expands includes and macro uses and queues everything else.
+func (a *assembler) line(pos position, tokens []token) {
+	if a.defining != nil {
+		if len(tokens) > 0 && strings.EqualFold(tokens[0].text, "ENDM") {
+			a.macros[a.defineName] = a.defining
+			a.defining = nil
+			return
+		}
+		a.defining.body = append(a.defining.body, sourceLine{pos: pos, tokens: tokens})
+		return
+	}
+
+	if len(tokens) >= 2 && tokens[0].kind == tokenIdent && tokens[1].is(":") {
+		label := tokens[0]
+		if a.checkName(pos, label) {
+			a.statements = append(a.statements, &statement{pos: pos, source: a.source(pos), label: &label})
+		}
+		tokens = tokens[2:]
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	if len(tokens) >= 2 && tokens[0].kind == tokenIdent &&
+		(tokens[1].is("=") || tokens[1].kind == tokenIdent && strings.EqualFold(tokens[1].text, "EQU")) {
+		a.defineConstant(pos, tokens[0], tokens[2:])
+		return
+	}
+
+	op := tokens[0]
+	if op.kind != tokenIdent {
+		a.errorf(pos, op.col, "expected an instruction, found %q", op.text)
+		return
+	}
+	args := splitArgs(tokens[1:])
+
+	switch name := strings.ToUpper(op.text); name {
+	case "INCLUDE":
+		if len(args) != 1 || len(args[0]) != 1 || args[0][0].kind != tokenString {
+			a.errorf(pos, op.col, "INCLUDE expects a quoted file name")
+			return
+		}
+		a.include(pos, args[0][0])
+	case "MACRO":
+		a.defineMacro(pos, op, args)
+	case "ENDM":
+		a.errorf(pos, op.col, "ENDM without MACRO")
+	default:
+		if m, ok := a.macros[name]; ok {
+			a.expand(pos, op, m, args)
+			return
+		}
+		a.statements = append(a.statements, &statement{pos: pos, source: a.source(pos), op: op, args: args})
+	}
+}
+
+// source returns the line the symbol map shows for a statement at pos: the
+// outermost macro use while expanding one.
+func (a *assembler) source(pos position) position {
+	if a.expanding > 0 {
+		return a.invocation
+	}
+	return pos
+}
+
+// splitArgs splits operands at the commas outside parentheses. Braces are
+// dropped so that optional operands printed as "SHR V1 {, V2}" assemble.
+func splitArgs(tokens []token) [][]token {
+	var args [][]token
+	var current []token
+	depth := 0
+	for _, t := range tokens {
+		switch {
+		case t.is("{") || t.is("}"):
+			continue
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case t.is(",") && depth == 0:
+			args = append(args, current)
+			current = nil
+			continue
+		}
+		current = append(current, t)
+	}
+	if current != nil || args != nil {
+		args = append(args, current)
+	}
+	return args
+}
+
+func (a *assembler) checkName(pos position, name token) bool {
+	if isReserved(name.text) {
+		a.errorf(pos, name.col, "%s is a reserved name", name.text)
+		return false
+	}
+	return true
+}
+
+func (a *assembler) defineConstant(pos position, name token, expr []token) {
+	if !a.checkName(pos, name) {
+		return
+	}
+	if len(expr) == 0 {
+		a.errorf(pos, name.col, "missing value for %s", name.text)
+		return
+	}
+	if _, ok := a.constants[name.text]; ok {
+		a.errorf(pos, name.col, "%s is already defined", name.text)
+		return
+	}
+	a.constants[name.text] = &constant{pos: pos, expr: expr}
+}
+
+func (a *assembler) include(pos position, name token) {
+	filename := name.text
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(pos.file), filename)
+	}
+	for _, open := range a.includes {
+		if open == filename {
+			a.errorf(pos, name.col, "%s includes itself", filename)
+			return
+		}
+	}
+	if len(a.includes) >= maxNesting {
+		a.errorf(pos, name.col, "includes nested too deeply")
+		return
+	}
+
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		a.errorf(pos, name.col, "%v", err)
+		return
+	}
+	a.readSource(filename, source)
+}
+
+// MACRO name param, param
+func (a *assembler) defineMacro(pos position, op token, args [][]token) {
+	if len(args) == 0 || len(args[0]) == 0 || args[0][0].kind != tokenIdent {
+		a.errorf(pos, op.col, "MACRO expects a name")
+		return
+	}
+	// the name and the first parameter are not separated by a comma
+	head := args[0]
+	args = append([][]token{head[1:]}, args[1:]...)
+	if len(head) == 1 {
+		args = args[1:]
+	}
+
+	name := head[0]
+	m := &macro{pos: pos}
+	for _, arg := range args {
+		if len(arg) != 1 || arg[0].kind != tokenIdent {
+			a.errorf(pos, op.col, "invalid parameters of MACRO %s", name.text)
+			return
+		}
+		m.params = append(m.params, arg[0].text)
+	}
+
+	upper := strings.ToUpper(name.text)
+	if _, ok := mnemonics[upper]; ok || isDirective(upper) {
+		a.errorf(pos, name.col, "macro %s hides an instruction", name.text)
+	} else if _, ok := a.macros[upper]; ok {
+		a.errorf(pos, name.col, "macro %s is already defined", name.text)
+	}
+	a.defining, a.defineName = m, upper
+}
+
+func (a *assembler) expand(pos position, op token, m *macro, args [][]token) {
+	if len(args) != len(m.params) {
+		a.errorf(pos, op.col, "%s expects %d arguments, got %d", op.text, len(m.params), len(args))
+		return
+	}
+	if a.expanding >= maxNesting {
+		a.errorf(pos, op.col, "macros nested too deeply")
+		return
+	}
+
+	bindings := make(map[string][]token)
+	for i, param := range m.params {
+		bindings[param] = args[i]
+	}
+
+	if a.expanding == 0 {
+		a.invocation = pos
+	}
+	a.expanding++
+	defer func() { a.expanding-- }()
+	for _, body := range m.body {
+		var tokens []token
+		for _, t := range body.tokens {
+			if arg, ok := bindings[t.text]; ok && t.kind == tokenIdent {
+				tokens = append(tokens, arg...)
+			} else {
+				tokens = append(tokens, t)
+			}
+		}
+		a.line(body.pos, tokens)
+	}
+}
+
+// layout assigns an address to every statement and defines the labels. It
+// returns false if the program does not fit in memory.
+func (a *assembler) layout() bool {
+	pc := startAddress
+	for _, s := range a.statements {
+		s.address = uint16(pc)
+		if s.label != nil {
+			if _, ok := a.labels[s.label.text]; ok {
+				a.errorf(s.pos, s.label.col, "label %s is already defined", s.label.text)
+			} else if _, ok := a.constants[s.label.text]; ok {
+				a.errorf(s.pos, s.label.col, "%s is already defined as a constant", s.label.text)
+			}
+			a.labels[s.label.text] = uint16(pc)
+			continue
+		}
+
+		switch strings.ToUpper(s.op.text) {
+		case "ORG":
+			if len(s.args) != 1 {
+				a.errorf(s.pos, s.op.col, "ORG expects an address")
+				continue
+			}
+			addr, ok := a.eval(s.pos, s.args[0])
+			if !ok {
+				continue
+			}
+			if addr < pc || addr > memorySize {
+				a.errorf(s.pos, s.op.col, "ORG $%03X is outside $%03X-$%03X", addr, pc, memorySize)
+				continue
+			}
+			pc = addr
+		default:
+			s.long = a.longLoad(s)
+			pc += a.size(s)
+		}
+
+		if pc > memorySize {
+			a.errorf(s.pos, s.op.col, "program does not fit in memory")
+			return false
+		}
+	}
+	return true
+}
+
+// encode is the second pass, producing the ROM.
+func (a *assembler) encode() []byte {
+	end := startAddress
+	for _, s := range a.statements {
+		if s.label == nil && !strings.EqualFold(s.op.text, "ORG") {
+			end = int(s.address) + a.size(s)
+		}
+	}
+
+	rom := make([]byte, end-startAddress)
+	for _, s := range a.statements {
+		if s.label != nil {
+			continue
+		}
+		at := rom[int(s.address)-startAddress:]
+
+		switch strings.ToUpper(s.op.text) {
+		case "ORG":
+		case "DB":
+			for _, arg := range s.args {
+				if len(arg) == 1 && arg[0].kind == tokenString {
+					at = at[copy(at, arg[0].text):]
+					continue
+				}
+				if value, ok := a.evalRange(s.pos, arg, -0x80, 0xFF); ok {
+					at[0] = byte(value)
+				}
+				at = at[1:]
+			}
+		case "DW":
+			for _, arg := range s.args {
+				if value, ok := a.evalRange(s.pos, arg, -0x8000, 0xFFFF); ok {
+					at[0], at[1] = byte(value>>8), byte(value)
+				}
+				at = at[2:]
+			}
+		default:
+			if s.long {
+				if value, ok := a.evalRange(s.pos, s.args[1], 0, 0xFFFF); ok {
+					at[0], at[1], at[2], at[3] = 0xF0, 0x00, byte(value>>8), byte(value)
+				}
+			} else if opcode, ok := a.instruction(s); ok {
+				at[0], at[1] = byte(opcode>>8), byte(opcode)
+			}
+		}
+	}
+	return rom
+}
+
+// symbols maps the addresses of the program to its labels, source lines and
+// data.
+func (a *assembler) symbols() *symbols.Map {
+	syms := &symbols.Map{}
+	for _, s := range a.statements {
+		switch op := strings.ToUpper(s.op.text); {
+		case s.label != nil:
+			syms.AddLabel(s.label.text, s.address)
+		case op == "ORG":
+		default:
+			size := a.size(s)
+			syms.AddLine(s.address, size, s.source.file, s.source.line)
+			if op == "DB" || op == "DW" {
+				syms.AddData(s.address, size)
+			}
+		}
+	}
+	return syms
+}
+
+func (a *assembler) size(s *statement) int {
+	switch strings.ToUpper(s.op.text) {
+	case "DB":
+		size := 0
+		for _, arg := range s.args {
+			if len(arg) == 1 && arg[0].kind == tokenString {
+				size += len(arg[0].text)
+			} else {
+				size++
+			}
+		}
+		return size
+	case "DW":
+		return 2 * len(s.args)
+	}
+	if s.long {
+		return 4
+	}
+	return 2
+}
+
+func isDirective(name string) bool {
+	switch name {
+	case "DB", "DW", "ORG", "INCLUDE", "MACRO", "ENDM", "EQU":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package assembler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kopi22/chip8/disasm"
+	"github.com/kopi22/chip8/emulator"
+)
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		source string
+		rom    []byte
+	}{
+		{"CLS", []byte{0x00, 0xE0}},
+		{"RET", []byte{0x00, 0xEE}},
+		{"SYS $123", []byte{0x01, 0x23}},
+		{"JP $2A4", []byte{0x12, 0xA4}},
+		{"JP V0, $300", []byte{0xB3, 0x00}},
+		{"CALL $208", []byte{0x22, 0x08}},
+		{"SE V3, $42", []byte{0x33, 0x42}},
+		{"SE V3, V4", []byte{0x53, 0x40}},
+		{"SNE VA, 255", []byte{0x4A, 0xFF}},
+		{"SNE VA, VB", []byte{0x9A, 0xB0}},
+		{"LD V1, %1010", []byte{0x61, 0x0A}},
+		{"LD V1, V2", []byte{0x81, 0x20}},
+		{"LD I, 0x345", []byte{0xA3, 0x45}},
+		{"LD V5, DT", []byte{0xF5, 0x07}},
+		{"LD V5, K", []byte{0xF5, 0x0A}},
+		{"LD DT, V6", []byte{0xF6, 0x15}},
+		{"LD ST, V7", []byte{0xF7, 0x18}},
+		{"LD F, V8", []byte{0xF8, 0x29}},
+		{"LD B, V9", []byte{0xF9, 0x33}},
+		{"LD [I], VE", []byte{0xFE, 0x55}},
+		{"LD VE, [I]", []byte{0xFE, 0x65}},
+		{"LD HF, V1", []byte{0xF1, 0x30}},
+		{"LD R, V2", []byte{0xF2, 0x75}},
+		{"LD V2, R", []byte{0xF2, 0x85}},
+		{"ADD V1, 1", []byte{0x71, 0x01}},
+		{"ADD V1, V2", []byte{0x81, 0x24}},
+		{"ADD I, V3", []byte{0xF3, 0x1E}},
+		{"OR V1, V2", []byte{0x81, 0x21}},
+		{"AND V1, V2", []byte{0x81, 0x22}},
+		{"XOR V1, V2", []byte{0x81, 0x23}},
+		{"SUB V1, V2", []byte{0x81, 0x25}},
+		{"SHR V1", []byte{0x81, 0x06}},
+		{"SHR V1 {, V2}", []byte{0x81, 0x26}},
+		{"SUBN V1, V2", []byte{0x81, 0x27}},
+		{"SHL V1, V2", []byte{0x81, 0x2E}},
+		{"RND V0, $0F", []byte{0xC0, 0x0F}},
+		{"DRW V1, V2, 5", []byte{0xD1, 0x25}},
+		{"SKP V4", []byte{0xE4, 0x9E}},
+		{"SKNP V4", []byte{0xE4, 0xA1}},
+		{"SCD 4", []byte{0x00, 0xC4}},
+		{"SCR", []byte{0x00, 0xFB}},
+		{"SCL", []byte{0x00, 0xFC}},
+		{"EXIT", []byte{0x00, 0xFD}},
+		{"LOW", []byte{0x00, 0xFE}},
+		{"HIGH", []byte{0x00, 0xFF}},
+		{"SCU 3", []byte{0x00, 0xD3}},
+		{"SAVE V1, V4", []byte{0x51, 0x42}},
+		{"LOAD V1, V4", []byte{0x51, 0x43}},
+		{"PLANE 3", []byte{0xF3, 0x01}},
+		{"AUDIO", []byte{0xF0, 0x02}},
+		{"PITCH V2", []byte{0xF2, 0x3A}},
+		{"BGC", []byte{0x02, 0xA0}},
+		{"ADDN V1, V2", []byte{0x51, 0x21}},
+		{"COL V1, V2, 3", []byte{0xB1, 0x23}},
+		{"SKP2 V1", []byte{0xE1, 0xF2}},
+		{"SKNP2 V1", []byte{0xE1, 0xF5}},
+		{"OUT V1", []byte{0xF1, 0xF8}},
+		{"IN V1", []byte{0xF1, 0xFB}},
+		{"ld v1, (2 + 3) * 4", []byte{0x61, 0x14}},
+		{"N = $10\nLD V0, N | 1", []byte{0x60, 0x11}},
+		{"LD I, $FFF", []byte{0xAF, 0xFF}},
+		{"LD I, $1234", []byte{0xF0, 0x00, 0x12, 0x34}},
+		{"N = $2000\nLD I, N + 1", []byte{0xF0, 0x00, 0x20, 0x01}},
+		{"LD I, $1234\nloop: JP loop", []byte{0xF0, 0x00, 0x12, 0x34, 0x12, 0x04}},
+		{"LD I, sprite\nsprite: DB $FF", []byte{0xA2, 0x02, 0xFF}},
+	}
+
+	for _, test := range tests {
+		program, err := Assemble("test.s", []byte(test.source))
+		if err != nil {
+			t.Errorf("%q: %v", test.source, err)
+			continue
+		}
+		if !bytes.Equal(program.Rom, test.rom) {
+			t.Errorf("%q assembled to % X, want % X", test.source, program.Rom, test.rom)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"FOO V1", "test.s:1:1: unknown instruction FOO"},
+		{"CLS\n  LD V1", "test.s:2:3: invalid operands for LD"},
+		{"  LD V1, $100", "test.s:1:10: value 256 is outside -128-255"},
+		{"  JP missing", "test.s:1:6: undefined symbol missing"},
+		{"DB \"abc", "test.s:1:4: unterminated string"},
+		{"  LD V1, #1", "test.s:1:10: unexpected character '#'"},
+		{"a:\na:", "test.s:2:1: label a is already defined"},
+		{"V1 = 3", "test.s:1:1: V1 is a reserved name"},
+		{"ENDM", "test.s:1:1: ENDM without MACRO"},
+		{"MACRO m\nCLS", "test.s:1:1: MACRO M has no ENDM"},
+		{"MACRO m a\nLD a, 1\nENDM\n  m", "test.s:4:3: m expects 1 arguments, got 0"},
+	}
+
+	for _, test := range tests {
+		_, err := Assemble("test.s", []byte(test.source))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %s", test.source, err, test.err)
+		}
+	}
+}
+
+func TestMacroLines(t *testing.T) {
+	source := "MACRO twice r\n  ADD r, 1\n  ADD r, 1\nENDM\n  LD V0, 0\n  twice V0\n"
+	program, err := Assemble("test.s", []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[uint16]int{0x200: 5, 0x202: 6, 0x204: 6}
+	for addr, line := range want {
+		source, ok := program.Symbols.Source(addr)
+		if !ok || source.Line != line {
+			t.Errorf("0x%03X maps to %v, want line %d", addr, source, line)
+		}
+	}
+}
+
+// listingAddress is the address each line of a listing starts with.
+var listingAddress = regexp.MustCompile(`(?m)^0x[0-9A-F]+ - `)
+
+// TestRoundTrip disassembles the bundled ROMs to listings and checks that
+// they assemble back to the same bytes.
+func TestRoundTrip(t *testing.T) {
+	roms, err := filepath.Glob("../roms/*.ch8")
+	if err != nil || len(roms) == 0 {
+		t.Fatalf("no ROMs found: %v", err)
+	}
+
+	for _, rom := range roms {
+		data, err := ioutil.ReadFile(rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		memory := make([]byte, emulator.INITIAL_PC+len(data))
+		copy(memory[emulator.INITIAL_PC:], data)
+		analysis := disasm.Analyze(disasm.PlatformChip8, memory, emulator.INITIAL_PC, uint16(len(memory)))
+
+		var listing strings.Builder
+		if err := disasm.WriteListing(&listing, analysis.Listing(disasm.DataBytesPerLine)); err != nil {
+			t.Fatal(err)
+		}
+		source := listingAddress.ReplaceAllString(listing.String(), "")
+
+		program, err := Assemble(rom, []byte(source))
+		if err != nil {
+			t.Errorf("%s: %v", rom, err)
+			continue
+		}
+		if !bytes.Equal(program.Rom, data) {
+			t.Errorf("%s: reassembled ROM differs", rom)
+		}
+	}
+}
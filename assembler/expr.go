@@ -0,0 +1,184 @@
+package assembler
+
+import (
+	"strings"
+)
+
+// reserved names can't be used for labels, constants or macro parameters.
+var reserved = map[string]bool{
+	"I": true, "DT": true, "ST": true, "K": true, "F": true, "B": true, "HF": true, "R": true,
+}
+
+func isReserved(name string) bool {
+	_, ok := register(name)
+	return ok || reserved[strings.ToUpper(name)]
+}
+
+// register parses V0-VF.
+func register(name string) (int, bool) {
+	if len(name) != 2 || name[0] != 'V' && name[0] != 'v' || !isDigit(name[1], 16) {
+		return 0, false
+	}
+	c := name[1] | 0x20 // lower case
+	if c <= '9' {
+		return int(c - '0'), true
+	}
+	return int(c-'a') + 10, true
+}
+
+// evaluator is a recursive descent parser of one expression:
+//
+//	expr    = term { ("+" | "-" | "&" | "|") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | name | "(" expr ")"
+type evaluator struct {
+	a      *assembler
+	pos    position
+	tokens []token
+	next   int
+	failed bool
+}
+
+// eval evaluates an expression, reporting errors at pos.
+func (a *assembler) eval(pos position, tokens []token) (int, bool) {
+	if len(tokens) == 0 {
+		a.errorf(pos, 1, "missing operand")
+		return 0, false
+	}
+
+	e := &evaluator{a: a, pos: pos, tokens: tokens}
+	value := e.expr()
+	if !e.failed && e.next < len(tokens) {
+		e.fail(tokens[e.next], "unexpected %q", tokens[e.next].text)
+	}
+	return value, !e.failed
+}
+
+// evalRange evaluates an expression that has to be within min and max.
+func (a *assembler) evalRange(pos position, tokens []token, min, max int) (int, bool) {
+	value, ok := a.eval(pos, tokens)
+	if ok && (value < min || value > max) {
+		a.errorf(pos, tokens[0].col, "value %d is outside %d-%d", value, min, max)
+		return 0, false
+	}
+	return value, ok
+}
+
+func (e *evaluator) fail(at token, format string, args ...interface{}) {
+	if !e.failed {
+		e.a.errorf(e.pos, at.col, format, args...)
+	}
+	e.failed = true
+}
+
+func (e *evaluator) peek(punct string) bool {
+	return e.next < len(e.tokens) && e.tokens[e.next].is(punct)
+}
+
+func (e *evaluator) expr() int {
+	value := e.term()
+	for !e.failed {
+		switch {
+		case e.peek("+"):
+			e.next++
+			value += e.term()
+		case e.peek("-"):
+			e.next++
+			value -= e.term()
+		case e.peek("&"):
+			e.next++
+			value &= e.term()
+		case e.peek("|"):
+			e.next++
+			value |= e.term()
+		default:
+			return value
+		}
+	}
+	return value
+}
+
+func (e *evaluator) term() int {
+	value := e.unary()
+	for !e.failed {
+		switch {
+		case e.peek("*"):
+			e.next++
+			value *= e.unary()
+		case e.peek("/"):
+			divisor := e.tokens[e.next]
+			e.next++
+			if d := e.unary(); d != 0 {
+				value /= d
+			} else {
+				e.fail(divisor, "division by zero")
+			}
+		default:
+			return value
+		}
+	}
+	return value
+}
+
+func (e *evaluator) unary() int {
+	if e.peek("-") {
+		e.next++
+		return -e.unary()
+	}
+	return e.primary()
+}
+
+func (e *evaluator) primary() int {
+	if e.next >= len(e.tokens) {
+		e.fail(e.tokens[len(e.tokens)-1], "incomplete expression")
+		return 0
+	}
+
+	t := e.tokens[e.next]
+	e.next++
+	switch {
+	case t.kind == tokenNumber:
+		return t.value
+	case t.kind == tokenIdent:
+		return e.symbol(t)
+	case t.is("("):
+		value := e.expr()
+		if !e.peek(")") {
+			e.fail(t, "missing )")
+			return 0
+		}
+		e.next++
+		return value
+	}
+	e.fail(t, "unexpected %q", t.text)
+	return 0
+}
+
+func (e *evaluator) symbol(t token) int {
+	if addr, ok := e.a.labels[t.text]; ok {
+		return int(addr)
+	}
+
+	c, ok := e.a.constants[t.text]
+	switch {
+	case !ok:
+		e.fail(t, "undefined symbol %s", t.text)
+		return 0
+	case c.done:
+		return c.value
+	case c.evaluating:
+		e.fail(t, "%s is defined in terms of itself", t.text)
+		return 0
+	}
+
+	c.evaluating = true
+	value, ok := e.a.eval(c.pos, c.expr)
+	c.evaluating = false
+	if !ok {
+		e.failed = true
+		return 0
+	}
+	c.value, c.done = value, true
+	return value
+}
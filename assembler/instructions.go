@@ -0,0 +1,191 @@
+package assembler
+
+import (
+	"strings"
+)
+
+// form is one way of writing a mnemonic. Operands lists the operand
+// patterns, separated by commas:
+//
+//	x, y   register encoded in the X or Y nibble; y? may be left out
+//	V0     register V0, not encoded
+//	kk     byte
+//	nnn    address
+//	n      nibble in the lowest 4 bits
+//	xn     nibble in the X position
+//
+// Any other pattern (I, [I], DT, ...) has to be written as is.
+type form struct {
+	operands string
+	opcode   uint16
+}
+
+var mnemonics = map[string][]form{
+	"CLS":  {{"", 0x00E0}},
+	"RET":  {{"", 0x00EE}},
+	"SYS":  {{"nnn", 0x0000}},
+	"JP":   {{"nnn", 0x1000}, {"V0,nnn", 0xB000}},
+	"CALL": {{"nnn", 0x2000}},
+	"SE":   {{"x,kk", 0x3000}, {"x,y", 0x5000}},
+	"SNE":  {{"x,kk", 0x4000}, {"x,y", 0x9000}},
+	"LD": {
+		{"x,kk", 0x6000}, {"x,y", 0x8000}, {"I,nnn", 0xA000},
+		{"x,DT", 0xF007}, {"x,K", 0xF00A}, {"DT,x", 0xF015}, {"ST,x", 0xF018},
+		{"F,x", 0xF029}, {"B,x", 0xF033}, {"[I],x", 0xF055}, {"x,[I]", 0xF065},
+		{"HF,x", 0xF030}, {"R,x", 0xF075}, {"x,R", 0xF085},
+	},
+	"ADD":  {{"x,kk", 0x7000}, {"x,y", 0x8004}, {"I,x", 0xF01E}},
+	"OR":   {{"x,y", 0x8001}},
+	"AND":  {{"x,y", 0x8002}},
+	"XOR":  {{"x,y", 0x8003}},
+	"SUB":  {{"x,y", 0x8005}},
+	"SHR":  {{"x,y?", 0x8006}},
+	"SUBN": {{"x,y", 0x8007}},
+	"SHL":  {{"x,y?", 0x800E}},
+	"RND":  {{"x,kk", 0xC000}},
+	"DRW":  {{"x,y,n", 0xD000}},
+	"SKP":  {{"x", 0xE09E}},
+	"SKNP": {{"x", 0xE0A1}},
+
+	// SCHIP
+	"SCD":  {{"n", 0x00C0}},
+	"SCR":  {{"", 0x00FB}},
+	"SCL":  {{"", 0x00FC}},
+	"EXIT": {{"", 0x00FD}},
+	"LOW":  {{"", 0x00FE}},
+	"HIGH": {{"", 0x00FF}},
+
+	// XO-CHIP
+	"SCU":   {{"n", 0x00D0}},
+	"SAVE":  {{"x,y", 0x5002}},
+	"LOAD":  {{"x,y", 0x5003}},
+	"PLANE": {{"xn", 0xF001}},
+	"AUDIO": {{"", 0xF002}},
+	"PITCH": {{"x", 0xF03A}},
+
+	// CHIP-8X
+	"BGC":   {{"", 0x02A0}},
+	"ADDN":  {{"x,y", 0x5001}},
+	"COL":   {{"x,y,n", 0xB000}},
+	"SKP2":  {{"x", 0xE0F2}},
+	"SKNP2": {{"x", 0xE0F5}},
+	"OUT":   {{"x", 0xF0F8}},
+	"IN":    {{"x", 0xF0FB}},
+}
+
+// instruction encodes an instruction statement.
+func (a *assembler) instruction(s *statement) (uint16, bool) {
+	name := strings.ToUpper(s.op.text)
+	forms, ok := mnemonics[name]
+	if !ok {
+		a.errorf(s.pos, s.op.col, "unknown instruction %s", s.op.text)
+		return 0, false
+	}
+
+	for _, f := range forms {
+		if patterns, ok := f.match(s.args); ok {
+			return a.encodeForm(s, f.opcode, patterns)
+		}
+	}
+	a.errorf(s.pos, s.op.col, "invalid operands for %s", name)
+	return 0, false
+}
+
+// longLoad reports whether s is LD I with an address above 0xFFF. The address
+// has to be known when s is laid out, so it is evaluated without reporting
+// errors; labels defined later are below 0x1000 anyway.
+func (a *assembler) longLoad(s *statement) bool {
+	if !strings.EqualFold(s.op.text, "LD") || len(s.args) != 2 || special(s.args[0]) != "I" || special(s.args[1]) != "" {
+		return false
+	}
+	errors := len(a.errors)
+	value, ok := a.eval(s.pos, s.args[1])
+	a.errors = a.errors[:errors]
+	return ok && value > 0xFFF
+}
+
+// match reports whether the operands have the kinds the form expects, and
+// returns the pattern of each operand.
+func (f form) match(args [][]token) ([]string, bool) {
+	var patterns []string
+	if f.operands != "" {
+		patterns = strings.Split(f.operands, ",")
+	}
+	if len(args) == len(patterns)-1 && strings.HasSuffix(f.operands, "?") {
+		patterns = patterns[:len(args)]
+	}
+	if len(args) != len(patterns) {
+		return nil, false
+	}
+
+	for i, pattern := range patterns {
+		arg := args[i]
+		reg, isReg := -1, false
+		if len(arg) == 1 && arg[0].kind == tokenIdent {
+			reg, isReg = register(arg[0].text)
+		}
+
+		switch pattern {
+		case "x", "y", "y?":
+			if !isReg {
+				return nil, false
+			}
+		case "V0":
+			if reg != 0 {
+				return nil, false
+			}
+		case "kk", "nnn", "n", "xn":
+			if isReg || special(arg) != "" {
+				return nil, false
+			}
+		default:
+			if special(arg) != pattern {
+				return nil, false
+			}
+		}
+	}
+	return patterns, true
+}
+
+// special returns the reserved operand an argument is, like "DT" or "[I]".
+func special(arg []token) string {
+	if len(arg) == 3 && arg[0].is("[") && arg[2].is("]") && strings.EqualFold(arg[1].text, "I") {
+		return "[I]"
+	}
+	if len(arg) == 1 && arg[0].kind == tokenIdent && reserved[strings.ToUpper(arg[0].text)] {
+		return strings.ToUpper(arg[0].text)
+	}
+	return ""
+}
+
+func (a *assembler) encodeForm(s *statement, opcode uint16, patterns []string) (uint16, bool) {
+	ok := true
+	for i, pattern := range patterns {
+		arg := s.args[i]
+		switch pattern {
+		case "x":
+			reg, _ := register(arg[0].text)
+			opcode |= uint16(reg) << 8
+		case "y", "y?":
+			reg, _ := register(arg[0].text)
+			opcode |= uint16(reg) << 4
+		case "kk":
+			value, valid := a.evalRange(s.pos, arg, -0x80, 0xFF)
+			opcode |= uint16(value) & 0xFF
+			ok = ok && valid
+		case "nnn":
+			value, valid := a.evalRange(s.pos, arg, 0, 0xFFF)
+			opcode |= uint16(value)
+			ok = ok && valid
+		case "n":
+			value, valid := a.evalRange(s.pos, arg, 0, 0xF)
+			opcode |= uint16(value)
+			ok = ok && valid
+		case "xn":
+			value, valid := a.evalRange(s.pos, arg, 0, 0xF)
+			opcode |= uint16(value) << 8
+			ok = ok && valid
+		}
+	}
+	return opcode, ok
+}
@@ -0,0 +1,120 @@
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value int // for numbers
+	col   int // 1-based column
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokenPunct && t.text == punct
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+func isDigit(c byte, base int) bool {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') < base
+	case c >= 'a' && c <= 'f':
+		return base == 16
+	case c >= 'A' && c <= 'F':
+		return base == 16
+	}
+	return false
+}
+
+// tokenize splits one source line into tokens. Comments start with ';'.
+// Numbers are decimal, $hex, 0xhex, %binary or 0bbinary.
+func tokenize(line string) ([]token, *Error) {
+	var tokens []token
+	for i := 0; i < len(line); {
+		c := line[i]
+		col := i + 1
+		switch {
+		case c == ';':
+			return tokens, nil
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '"':
+			end := strings.IndexByte(line[i+1:], '"')
+			if end < 0 {
+				return nil, &Error{Column: col, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: line[i+1 : i+1+end], col: col})
+			i += end + 2
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(line) && isIdentChar(line[j]) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: line[i:j], col: col})
+			i = j
+		case c >= '0' && c <= '9', c == '$' || c == '%' && i+1 < len(line) && isDigit(line[i+1], 2):
+			t, n, err := lexNumber(line[i:])
+			if err != nil {
+				return nil, &Error{Column: col, Msg: err.Error()}
+			}
+			t.col = col
+			tokens = append(tokens, t)
+			i += n
+		case strings.ContainsRune(",:[](){}+-*/&|=", rune(c)):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c), col: col})
+			i++
+		default:
+			return nil, &Error{Column: col, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return tokens, nil
+}
+
+func lexNumber(s string) (token, int, error) {
+	base, start := 10, 0
+	switch {
+	case s[0] == '$':
+		base, start = 16, 1
+	case s[0] == '%':
+		base, start = 2, 1
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		base, start = 16, 2
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		base, start = 2, 2
+	}
+
+	end := start
+	for end < len(s) && (isDigit(s[end], base) || s[end] == '_') {
+		end++
+	}
+	if end < len(s) && isIdentChar(s[end]) {
+		return token{}, 0, fmt.Errorf("invalid number %q", s[:end+1])
+	}
+
+	digits := strings.Replace(s[start:end], "_", "", -1)
+	value, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || digits == "" {
+		return token{}, 0, fmt.Errorf("invalid number %q", s[:end])
+	}
+	return token{kind: tokenNumber, text: s[:end], value: int(value)}, end, nil
+}
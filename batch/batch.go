@@ -0,0 +1,81 @@
+// Command batch runs a ROM headlessly, without a terminal, as fast as it can
+// and saves a screenshot of the display when it is done. The run can also be
+// recorded as an animated GIF or Y4M video.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kopi22/chip8/config"
+	"github.com/kopi22/chip8/emulator"
+)
+
+func main() {
+	frames := flag.Int("frames", 600, "number of frames to run, 60 per second")
+	tickRate := flag.Int("tickrate", 0, "instructions per frame, by default the emulator's speed or the one of the ROM")
+	screenshot := flag.String("screenshot", "", "write the display to this PNG file when done, by default the ROM name with a .png extension in the current directory")
+	scale := flag.Int("scale", emulator.DefaultScreenshotScale, "size in image pixels of every display pixel")
+	configFile := flag.String("config", "", "config file, by default chip8/config.json in the user config directory")
+	paletteName := flag.String("palette", "", "palette of the screenshot and the recording, unless the ROM brings its own colours")
+	record := flag.String("record", "", "record every frame of the run to this .gif or .y4m file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: batch [flags] rom.ch8\n\nROMs are looked up in the roms directory, like the emulator does.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *frames, *tickRate, *screenshot, *record, *scale, *configFile, *paletteName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(romFilename string, frames, tickRate int, screenshot, record string, scale int, configFile, paletteName string) error {
+	settings, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return err
+	}
+	palettes, err := settings.AllPalettes()
+	if err != nil {
+		return err
+	}
+	if paletteName == "" {
+		paletteName = settings.Palette
+	}
+
+	emu := emulator.NewEmulator().
+		SetPalettes(palettes).
+		SetScreenshotScale(scale)
+	if paletteName != "" {
+		if err := emu.SelectPalette(paletteName); err != nil {
+			return err
+		}
+	}
+
+	emu.LoadRom(romFilename)
+	// after loading, which applies the tick rate of the ROM
+	emu.SetTickRate(tickRate)
+	if record != "" {
+		if err := emu.StartRecording(record); err != nil {
+			return err
+		}
+	}
+	emu.RunFrames(frames)
+	if err := emu.StopRecording(); err != nil {
+		return err
+	}
+
+	if screenshot == "" {
+		name := filepath.Base(romFilename)
+		screenshot = strings.TrimSuffix(name, filepath.Ext(name)) + emulator.ScreenshotExtension
+	}
+	return emu.SaveScreenshot(screenshot)
+}
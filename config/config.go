@@ -0,0 +1,101 @@
+// Package config reads the user's settings for the emulator, a JSON file
+// like:
+//
+//	{
+//		"palette": "amber",
+//		"palettes": {
+//			"mine": ["#000000", "#FF00FF", "#00FFFF", "#FFFFFF"]
+//		}
+//	}
+//
+// Palettes list the background, the lit pixels and, for XO-CHIP, the second
+// plane and the pixels lit on both planes.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kopi22/chip8/emulator/io"
+)
+
+type Config struct {
+	// Palette names the palette to start with.
+	Palette  string              `json:"palette"`
+	Palettes map[string][]string `json:"palettes"`
+}
+
+// DefaultPath returns where the config file is looked for by default, e.g.
+// ~/.config/chip8/config.json on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "config.json"), nil
+}
+
+func Load(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return config, nil
+}
+
+// LoadOrDefault reads the named config file, or the one at DefaultPath if
+// there is one. Without a config file the settings are empty.
+func LoadOrDefault(filename string) (*Config, error) {
+	if filename != "" {
+		return Load(filename)
+	}
+
+	filename, err := DefaultPath()
+	if err != nil {
+		return &Config{}, nil
+	}
+	config, err := Load(filename)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	return config, err
+}
+
+// AllPalettes returns the builtin palettes followed by the user's, in name
+// order. A user palette replaces the builtin one of the same name.
+func (config *Config) AllPalettes() ([]io.NamedPalette, error) {
+	names := make([]string, 0, len(config.Palettes))
+	for name := range config.Palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	palettes := append([]io.NamedPalette(nil), io.BuiltinPalettes...)
+	for _, name := range names {
+		palette, err := io.ParsePalette(config.Palettes[name]...)
+		if err != nil {
+			return nil, fmt.Errorf("palette %s: %v", name, err)
+		}
+
+		replaced := false
+		for i := range palettes {
+			if palettes[i].Name == name {
+				palettes[i].Palette = palette
+				replaced = true
+			}
+		}
+		if !replaced {
+			palettes = append(palettes, io.NamedPalette{Name: name, Palette: palette})
+		}
+	}
+	return palettes, nil
+}
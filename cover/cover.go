@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kopi22/chip8/coverage"
+	"github.com/kopi22/chip8/disasm"
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/symbols"
+)
+
+func main() {
+	htmlFile := flag.String("html", "", "write an HTML report to this file instead of the text report")
+	output := flag.String("o", "", "write the merged coverage to this file")
+	platformName := flag.String("platform", string(disasm.PlatformChip8), "instruction set: chip8, schip, xochip or chip8x")
+	symbolFile := flag.String("sym", "", "symbol map of the ROM, by default the ROM name with a .sym extension if there is one")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: cover [flags] rom.ch8 run.cov...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Args()[1:], *platformName, *symbolFile, *output, *htmlFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(romFilename string, runs []string, platformName, symbolFile, output, htmlFile string) error {
+	platform, err := disasm.ParsePlatform(platformName)
+	if err != nil {
+		return err
+	}
+
+	// merge the coverage of all the runs
+	merged := coverage.New()
+	for _, filename := range runs {
+		c, err := coverage.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		merged.Merge(c)
+	}
+	if output != "" {
+		if err := merged.WriteFile(output); err != nil {
+			return err
+		}
+	}
+
+	rom, err := ioutil.ReadFile(romFilename)
+	if err != nil {
+		return err
+	}
+	memory := make([]byte, emulator.INITIAL_PC+len(rom))
+	copy(memory[emulator.INITIAL_PC:], rom)
+	syms, err := symbols.ReadForROM(symbolFile, romFilename)
+	if err != nil {
+		return err
+	}
+
+	analysis := disasm.AnalyzeWithSymbols(platform, memory, emulator.INITIAL_PC, uint16(len(memory)), syms, merged.Addresses()...)
+	report := coverage.BuildReport(analysis, merged)
+	if htmlFile == "" {
+		return report.WriteText(os.Stdout)
+	}
+
+	file, err := os.Create(htmlFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := report.WriteHTML(file, filepath.Base(romFilename)); err != nil {
+		return err
+	}
+	return file.Close()
+}
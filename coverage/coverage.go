@@ -0,0 +1,207 @@
+// Package coverage records which instructions of a CHIP-8 program ran and
+// which way its skips went, so tests of a ROM can show what they missed.
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kopi22/chip8/emulator"
+)
+
+// Extension is the usual extension of coverage files.
+const Extension = ".cov"
+
+// Outcomes counts how often a skip instruction skipped and how often it let
+// the next instruction run.
+type Outcomes struct {
+	Taken    int64
+	NotTaken int64
+}
+
+// Coverage is an emulator.Observer counting the executions of each address.
+// It is written as a text file holding one record per line:
+//
+//	exec 0x200 15
+//	skip 0x204 3 12
+//
+// where the skip record gives the times the skip was taken and not taken.
+type Coverage struct {
+	Executed map[uint16]int64
+	Skips    map[uint16]Outcomes
+
+	// the skip whose outcome is known once the next instruction is fetched
+	pendingSkip bool
+	skipAddress uint16
+}
+
+func New() *Coverage {
+	return &Coverage{
+		Executed: make(map[uint16]int64),
+		Skips:    make(map[uint16]Outcomes),
+	}
+}
+
+func (c *Coverage) BeforeExecute(state *emulator.State, instruction emulator.Instruction) {
+	if c.pendingSkip {
+		outcomes := c.Skips[c.skipAddress]
+		if state.PC == c.skipAddress+2 {
+			outcomes.NotTaken++
+		} else {
+			outcomes.Taken++
+		}
+		c.Skips[c.skipAddress] = outcomes
+		c.pendingSkip = false
+	}
+
+	c.Executed[state.PC]++
+	if isSkip(instruction) {
+		c.pendingSkip = true
+		c.skipAddress = state.PC
+	}
+}
+
+// isSkip reports whether the instruction is one of the conditional skips of
+// any of the supported platforms.
+func isSkip(instruction emulator.Instruction) bool {
+	switch instruction >> 12 {
+	case 0x3, 0x4:
+		return true
+	case 0x5, 0x9:
+		return instruction&0xF == 0
+	case 0xE:
+		switch instruction.GetKK() {
+		case 0x9E, 0xA1, 0xF2, 0xF5:
+			return true
+		}
+	}
+	return false
+}
+
+// Addresses returns the addresses that ran, in order.
+func (c *Coverage) Addresses() []uint16 {
+	addrs := make([]uint16, 0, len(c.Executed))
+	for addr := range c.Executed {
+		addrs = append(addrs, addr)
+	}
+	return sortAddresses(addrs)
+}
+
+// Merge adds the counts of other, e.g. from another run of the same program.
+func (c *Coverage) Merge(other *Coverage) {
+	for addr, count := range other.Executed {
+		c.Executed[addr] += count
+	}
+	for addr, outcomes := range other.Skips {
+		merged := c.Skips[addr]
+		merged.Taken += outcomes.Taken
+		merged.NotTaken += outcomes.NotTaken
+		c.Skips[addr] = merged
+	}
+}
+
+func (c *Coverage) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	for _, addr := range c.Addresses() {
+		fmt.Fprintf(out, "exec 0x%03X %d\n", addr, c.Executed[addr])
+	}
+
+	skips := make([]uint16, 0, len(c.Skips))
+	for addr := range c.Skips {
+		skips = append(skips, addr)
+	}
+	for _, addr := range sortAddresses(skips) {
+		outcomes := c.Skips[addr]
+		fmt.Fprintf(out, "skip 0x%03X %d %d\n", addr, outcomes.Taken, outcomes.NotTaken)
+	}
+	return out.Flush()
+}
+
+func (c *Coverage) WriteFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := c.Write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Read parses a coverage file. Records of the same address add up, so that
+// files can simply be concatenated.
+func Read(r io.Reader) (*Coverage, error) {
+	c := New()
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "exec":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected 'exec ADDRESS COUNT'", lineNo)
+			}
+			addr, counts, err := parseRecord(fields[1], fields[2:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			c.Executed[addr] += counts[0]
+		case "skip":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("line %d: expected 'skip ADDRESS TAKEN NOT-TAKEN'", lineNo)
+			}
+			addr, counts, err := parseRecord(fields[1], fields[2:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			outcomes := c.Skips[addr]
+			outcomes.Taken += counts[0]
+			outcomes.NotTaken += counts[1]
+			c.Skips[addr] = outcomes
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func ReadFile(filename string) (*Coverage, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+func parseRecord(address string, counts []string) (uint16, []int64, error) {
+	addr, err := strconv.ParseUint(address, 0, 16)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid address %q", address)
+	}
+	values := make([]int64, len(counts))
+	for i, count := range counts {
+		values[i], err = strconv.ParseInt(count, 10, 64)
+		if err != nil || values[i] < 0 {
+			return 0, nil, fmt.Errorf("invalid count %q", count)
+		}
+	}
+	return uint16(addr), values, nil
+}
+
+func sortAddresses(addrs []uint16) []uint16 {
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
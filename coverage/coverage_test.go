@@ -0,0 +1,123 @@
+package coverage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kopi22/chip8/emulator"
+)
+
+// skips takes its first skip and not its second, then loops forever.
+var skips = []byte{
+	0x60, 0x05, // 0x200 LD V0, 5
+	0x30, 0x05, // 0x202 SE V0, 5
+	0x60, 0x00, // 0x204 LD V0, 0
+	0x30, 0x06, // 0x206 SE V0, 6
+	0x12, 0x08, // 0x208 JP 0x208
+}
+
+const skipsCoverage = `exec 0x200 1
+exec 0x202 1
+exec 0x206 1
+exec 0x208 2
+skip 0x202 1 0
+skip 0x206 0 1
+`
+
+// run executes rom with the emulator's instruction handlers for the given
+// number of steps, reporting every instruction to c.
+func run(c *Coverage, rom []byte, steps int) {
+	state := emulator.InitChipState()
+	copy(state.Memory[emulator.INITIAL_PC:], rom)
+	for i := 0; i < steps; i++ {
+		instruction := emulator.FetchInstruction(state.Memory, state.PC)
+		c.BeforeExecute(state, instruction)
+		state.PC += 2
+		switch instruction >> 12 {
+		case 0x1:
+			emulator.Op1(state, instruction)
+		case 0x3:
+			emulator.Op3(state, instruction)
+		case 0x6:
+			emulator.Op6(state, instruction)
+		}
+	}
+}
+
+func TestSkipOutcomes(t *testing.T) {
+	c := New()
+	run(c, skips, 5)
+
+	executed := map[uint16]int64{0x200: 1, 0x202: 1, 0x206: 1, 0x208: 2}
+	if !reflect.DeepEqual(c.Executed, executed) {
+		t.Errorf("executed %v, want %v", c.Executed, executed)
+	}
+	outcomes := map[uint16]Outcomes{0x202: {Taken: 1}, 0x206: {NotTaken: 1}}
+	if !reflect.DeepEqual(c.Skips, outcomes) {
+		t.Errorf("skips %v, want %v", c.Skips, outcomes)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	c := New()
+	run(c, skips, 5)
+
+	var out strings.Builder
+	if err := c.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != skipsCoverage {
+		t.Errorf("wrote\n%s\nwant\n%s", out.String(), skipsCoverage)
+	}
+
+	read, err := Read(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Executed, c.Executed) || !reflect.DeepEqual(read.Skips, c.Skips) {
+		t.Errorf("read back %v %v, want %v %v", read.Executed, read.Skips, c.Executed, c.Skips)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	first := New()
+	run(first, skips, 5)
+	second := New()
+	run(second, skips, 3)
+
+	var out strings.Builder
+	first.Write(&out)
+	second.Write(&out)
+	concatenated, err := Read(strings.NewReader("# two runs\n\n" + out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.Merge(second)
+	executed := map[uint16]int64{0x200: 2, 0x202: 2, 0x206: 2, 0x208: 2}
+	outcomes := map[uint16]Outcomes{0x202: {Taken: 2}, 0x206: {NotTaken: 1}}
+	for _, c := range []*Coverage{first, concatenated} {
+		if !reflect.DeepEqual(c.Executed, executed) || !reflect.DeepEqual(c.Skips, outcomes) {
+			t.Errorf("merged %v %v, want %v %v", c.Executed, c.Skips, executed, outcomes)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"exec 0x200\n", "line 1: expected 'exec ADDRESS COUNT'"},
+		{"exec 0x200 1\nskip 0x202 1\n", "line 2: expected 'skip ADDRESS TAKEN NOT-TAKEN'"},
+		{"exec start 1\n", `line 1: invalid address "start"`},
+		{"skip 0x202 1 -1\n", `line 1: invalid count "-1"`},
+	}
+
+	for _, test := range tests {
+		if _, err := Read(strings.NewReader(test.input)); err == nil || err.Error() != test.err {
+			t.Errorf("%q: error %v, want %s", test.input, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/kopi22/chip8/disasm"
+)
+
+type Status string
+
+const (
+	StatusData      Status = "data"
+	StatusCovered   Status = "covered"
+	StatusPartial   Status = "partial" // a skip that only went one way
+	StatusUncovered Status = "uncovered"
+)
+
+// Line is one line of the annotated disassembly.
+type Line struct {
+	disasm.Item
+	Text   string
+	Status Status
+	Count  int64
+	// Skip is set for skip instructions, with the outcomes seen.
+	Skip     bool
+	Outcomes Outcomes
+}
+
+type Report struct {
+	Lines []Line
+	// Instructions and Covered count the instructions of the listing, and
+	// SkipOutcomes and CoveredOutcomes the two ways each skip can go.
+	Instructions, Covered         int
+	SkipOutcomes, CoveredOutcomes int
+}
+
+// BuildReport annotates the listing of an analysed program with coverage.
+// The analysis should be given the addresses that ran as entry points, so
+// that code only reached through JP V0 or self-modification is listed too.
+func BuildReport(a *disasm.Analysis, c *Coverage) *Report {
+	r := &Report{}
+	for _, item := range a.Listing(disasm.DataBytesPerLine) {
+		line := Line{Item: item, Status: StatusData}
+		if item.Instruction == nil {
+			line.Text = fmt.Sprintf("DB %s", disasm.FormatBytes(item.Data))
+			r.Lines = append(r.Lines, line)
+			continue
+		}
+
+		d := item.Instruction
+		line.Text = d.String()
+		line.Count = c.Executed[item.Address]
+		line.Status = StatusUncovered
+		r.Instructions++
+		if line.Count > 0 {
+			line.Status = StatusCovered
+			r.Covered++
+		}
+
+		if d.Class == disasm.ClassSkip {
+			line.Skip = true
+			line.Outcomes = c.Skips[item.Address]
+			r.SkipOutcomes += 2
+			for _, count := range []int64{line.Outcomes.Taken, line.Outcomes.NotTaken} {
+				if count > 0 {
+					r.CoveredOutcomes++
+				}
+			}
+			if line.Count > 0 && (line.Outcomes.Taken == 0 || line.Outcomes.NotTaken == 0) {
+				line.Status = StatusPartial
+			}
+		}
+		r.Lines = append(r.Lines, line)
+	}
+	return r
+}
+
+// Summary gives the percentages of instructions and skip outcomes covered.
+func (r *Report) Summary() string {
+	return fmt.Sprintf("instructions: %d/%d (%s), skip outcomes: %d/%d (%s)",
+		r.Covered, r.Instructions, percent(r.Covered, r.Instructions),
+		r.CoveredOutcomes, r.SkipOutcomes, percent(r.CoveredOutcomes, r.SkipOutcomes))
+}
+
+func percent(part, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(total))
+}
+
+// Annotation describes the outcomes of a skip, e.g. "skip never taken".
+func (line Line) Annotation() string {
+	switch {
+	case !line.Skip || line.Count == 0:
+		return ""
+	case line.Outcomes.Taken == 0:
+		return "skip never taken"
+	case line.Outcomes.NotTaken == 0:
+		return "skip always taken"
+	}
+	return fmt.Sprintf("skip taken %d, not taken %d", line.Outcomes.Taken, line.Outcomes.NotTaken)
+}
+
+// WriteText prints the listing gcov style: each instruction is preceded by
+// the times it ran, or ##### if it never did.
+func (r *Report) WriteText(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, r.Summary())
+	for _, line := range r.Lines {
+		if line.Label != "" {
+			fmt.Fprintf(out, "%10s  %s:\n", "", line.Label)
+		}
+
+		count := "-"
+		switch line.Status {
+		case StatusUncovered:
+			count = "#####"
+		case StatusCovered, StatusPartial:
+			count = fmt.Sprint(line.Count)
+		}
+		text := fmt.Sprintf("%10s  0x%03X - %s", count, line.Address, line.Text)
+
+		var comments []string
+		if annotation := line.Annotation(); annotation != "" {
+			comments = append(comments, annotation)
+		}
+		if line.Source != "" {
+			comments = append(comments, line.Source)
+		}
+		for i, comment := range comments {
+			if i == 0 {
+				text = fmt.Sprintf("%-44s ; %s", text, comment)
+			} else {
+				text += ", " + comment
+			}
+		}
+		fmt.Fprintln(out, text)
+	}
+	return out.Flush()
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} coverage</title>
+<style>
+body { font-family: monospace; background: #fff; color: #222; }
+table { border-collapse: collapse; }
+td { padding: 0 0.6em; white-space: pre; }
+td.count { text-align: right; color: #666; }
+tr.covered { background: #dfd; }
+tr.partial { background: #ffd; }
+tr.uncovered { background: #fdd; }
+tr.data { color: #888; }
+tr.label td { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Report.Summary}}</p>
+<table>
+{{range .Report.Lines}}{{if .Label}}<tr class="label"><td></td><td colspan="4">{{.Label}}:</td></tr>
+{{end}}<tr class="{{.Status}}"><td class="count">{{if eq .Status "uncovered"}}#####{{else if eq .Status "data"}}-{{else}}{{.Count}}{{end}}</td><td>{{printf "0x%03X" .Address}}</td><td>{{.Text}}</td><td>{{.Annotation}}</td><td>{{.Source}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the listing as a web page, with uncovered instructions in
+// red and skips that only went one way in yellow.
+func (r *Report) WriteHTML(w io.Writer, title string) error {
+	return htmlReport.Execute(w, struct {
+		Title  string
+		Report *Report
+	}{title, r})
+}
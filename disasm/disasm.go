@@ -0,0 +1,317 @@
+package disasm
+
+import (
+	"fmt"
+
+	"github.com/kopi22/chip8/emulator"
+)
+
+// Platform selects the instruction set to decode.
+type Platform string
+
+const (
+	PlatformChip8  Platform = "chip8"
+	PlatformSCHIP  Platform = "schip"
+	PlatformXOChip Platform = "xochip"
+	PlatformChip8X Platform = "chip8x"
+)
+
+func ParsePlatform(name string) (Platform, error) {
+	switch platform := Platform(name); platform {
+	case PlatformChip8, PlatformSCHIP, PlatformXOChip, PlatformChip8X:
+		return platform, nil
+	}
+	return "", fmt.Errorf("unknown platform %q", name)
+}
+
+// superChip reports whether the platform includes the SCHIP instructions.
+func (platform Platform) superChip() bool {
+	return platform == PlatformSCHIP || platform == PlatformXOChip
+}
+
+type Class string
+
+const (
+	ClassInvalid  Class = "invalid"
+	ClassSystem   Class = "system"
+	ClassJump     Class = "jump"
+	ClassCall     Class = "call"
+	ClassReturn   Class = "return"
+	ClassSkip     Class = "skip"
+	ClassLoad     Class = "load"
+	ClassArith    Class = "arithmetic"
+	ClassLogic    Class = "logic"
+	ClassMemory   Class = "memory"
+	ClassDisplay  Class = "display"
+	ClassInput    Class = "input"
+	ClassTimer    Class = "timer"
+	ClassRandom   Class = "random"
+	ClassSound    Class = "sound"
+	ClassIO       Class = "io"
+	ClassExit     Class = "exit"
+	ClassIndirect Class = "indirect" // jump through a register, target unknown
+)
+
+// Decoded is a single disassembled instruction.
+type Decoded struct {
+	Address  uint16
+	Opcode   emulator.Instruction
+	Size     uint16
+	Mnemonic string
+	Operands []Operand
+	Class    Class
+	// Targets lists the addresses control may move to other than the next
+	// instruction: the destination of jumps and calls, and the instruction
+	// after the skipped one for skips.
+	Targets []uint16
+}
+
+func (d Decoded) Valid() bool {
+	return d.Class != ClassInvalid
+}
+
+// FallsThrough reports whether execution may continue at the next instruction.
+func (d Decoded) FallsThrough() bool {
+	switch d.Class {
+	case ClassJump, ClassReturn, ClassIndirect, ClassExit, ClassInvalid:
+		return false
+	}
+	return true
+}
+
+func (d Decoded) Next() uint16 {
+	return d.Address + d.Size
+}
+
+// Decode decodes the instruction at addr. Addresses past the end of memory
+// read as zero.
+func Decode(platform Platform, memory []byte, addr uint16) Decoded {
+	instruction := emulator.Instruction(readWord(memory, addr))
+
+	d := Decoded{
+		Address: addr,
+		Opcode:  instruction,
+		Size:    2,
+		Class:   ClassInvalid,
+	}
+	decodeInstruction(&d, instruction)
+	if platform.superChip() {
+		decodeSuperChip(&d, instruction)
+	}
+	switch platform {
+	case PlatformXOChip:
+		decodeXOChip(&d, instruction, memory)
+	case PlatformChip8X:
+		decodeChip8X(&d, instruction)
+	}
+
+	// XO-CHIP skips jump over the whole of a following 4 byte instruction
+	if d.Class == ClassSkip && platform == PlatformXOChip && readWord(memory, addr+2) == 0xF000 {
+		d.Targets = []uint16{addr + 6}
+	}
+
+	return d
+}
+
+func readWord(memory []byte, addr uint16) uint16 {
+	var hi, lo byte
+	if int(addr) < len(memory) {
+		hi = memory[addr]
+	}
+	if int(addr)+1 < len(memory) {
+		lo = memory[addr+1]
+	}
+	return uint16(hi)<<8 | uint16(lo)
+}
+
+// Disassemble linearly decodes every instruction in [start, end).
+func Disassemble(platform Platform, memory []byte, start, end uint16) []Decoded {
+	var decoded []Decoded
+	for addr := start; addr < end; {
+		d := Decode(platform, memory, addr)
+		decoded = append(decoded, d)
+		addr += d.Size
+	}
+
+	return decoded
+}
+
+func (d *Decoded) set(class Class, mnemonic string, operands ...Operand) {
+	d.Class = class
+	d.Mnemonic = mnemonic
+	d.Operands = operands
+	d.Targets = nil
+}
+
+func decodeInstruction(d *Decoded, instruction emulator.Instruction) {
+	x, y := Reg(instruction.GetX()), Reg(instruction.GetY())
+	kk := Byte(instruction.GetKK())
+	nnn := instruction.GetNNN()
+
+	// first NIBBLE determines the instruction type
+	switch instruction >> 12 {
+	case 0x0:
+		switch uint16(instruction) {
+		case 0x00E0:
+			d.set(ClassDisplay, "CLS")
+		case 0x00EE:
+			d.set(ClassReturn, "RET")
+		default:
+			// SYS addr - call to a machine code routine of the host
+			d.set(ClassSystem, "SYS", Target(nnn))
+		}
+	case 0x1:
+		d.set(ClassJump, "JP", Target(nnn))
+		d.Targets = []uint16{nnn}
+	case 0x2:
+		d.set(ClassCall, "CALL", Target(nnn))
+		d.Targets = []uint16{nnn}
+	case 0x3:
+		d.setSkip("SE", x, kk)
+	case 0x4:
+		d.setSkip("SNE", x, kk)
+	case 0x5:
+		if instruction&0x000F == 0x0 {
+			d.setSkip("SE", x, y)
+		}
+	case 0x6:
+		d.set(ClassLoad, "LD", x, kk)
+	case 0x7:
+		d.set(ClassArith, "ADD", x, kk)
+	case 0x8:
+		switch instruction & 0x000F {
+		case 0x0:
+			d.set(ClassLoad, "LD", x, y)
+		case 0x1:
+			d.set(ClassLogic, "OR", x, y)
+		case 0x2:
+			d.set(ClassLogic, "AND", x, y)
+		case 0x3:
+			d.set(ClassLogic, "XOR", x, y)
+		case 0x4:
+			d.set(ClassArith, "ADD", x, y)
+		case 0x5:
+			d.set(ClassArith, "SUB", x, y)
+		case 0x6:
+			d.set(ClassLogic, "SHR", x, OptionalReg(instruction.GetY()))
+		case 0x7:
+			d.set(ClassArith, "SUBN", x, y)
+		case 0xe:
+			d.set(ClassLogic, "SHL", x, OptionalReg(instruction.GetY()))
+		}
+	case 0x9:
+		if instruction&0x000F == 0x0 {
+			d.setSkip("SNE", x, y)
+		}
+	case 0xa:
+		d.set(ClassLoad, "LD", Special(OperandI), Addr(nnn))
+	case 0xb:
+		d.set(ClassIndirect, "JP", Reg(0), Addr(nnn))
+	case 0xc:
+		d.set(ClassRandom, "RND", x, kk)
+	case 0xd:
+		d.set(ClassDisplay, "DRW", x, y, Nibble(instruction.GetN()))
+	case 0xe:
+		switch instruction & 0x00FF {
+		case 0x9e:
+			d.setSkip("SKP", x)
+		case 0xA1:
+			d.setSkip("SKNP", x)
+		}
+	case 0xf:
+		switch instruction & 0xFF {
+		case 0x07:
+			d.set(ClassTimer, "LD", x, Special(OperandDT))
+		case 0x0A:
+			d.set(ClassInput, "LD", x, Special(OperandK))
+		case 0x15:
+			d.set(ClassTimer, "LD", Special(OperandDT), x)
+		case 0x18:
+			d.set(ClassTimer, "LD", Special(OperandST), x)
+		case 0x1e:
+			d.set(ClassArith, "ADD", Special(OperandI), x)
+		case 0x29:
+			d.set(ClassLoad, "LD", Special(OperandF), x)
+		case 0x33:
+			d.set(ClassMemory, "LD", Special(OperandB), x)
+		case 0x55:
+			d.set(ClassMemory, "LD", Special(OperandIndirectI), x)
+		case 0x65:
+			d.set(ClassMemory, "LD", x, Special(OperandIndirectI))
+		}
+	}
+}
+
+func (d *Decoded) setSkip(mnemonic string, operands ...Operand) {
+	d.set(ClassSkip, mnemonic, operands...)
+	d.Targets = []uint16{d.Address + 4}
+}
+
+func decodeSuperChip(d *Decoded, instruction emulator.Instruction) {
+	x := Reg(instruction.GetX())
+
+	switch {
+	case instruction&0xFFF0 == 0x00C0:
+		d.set(ClassDisplay, "SCD", Nibble(instruction.GetN()))
+	case instruction == 0x00FB:
+		d.set(ClassDisplay, "SCR")
+	case instruction == 0x00FC:
+		d.set(ClassDisplay, "SCL")
+	case instruction == 0x00FD:
+		d.set(ClassExit, "EXIT")
+	case instruction == 0x00FE:
+		d.set(ClassDisplay, "LOW")
+	case instruction == 0x00FF:
+		d.set(ClassDisplay, "HIGH")
+	case instruction&0xF0FF == 0xF030:
+		d.set(ClassLoad, "LD", Special(OperandHF), x)
+	case instruction&0xF0FF == 0xF075:
+		d.set(ClassMemory, "LD", Special(OperandR), x)
+	case instruction&0xF0FF == 0xF085:
+		d.set(ClassMemory, "LD", x, Special(OperandR))
+	}
+}
+
+func decodeXOChip(d *Decoded, instruction emulator.Instruction, memory []byte) {
+	x, y := Reg(instruction.GetX()), Reg(instruction.GetY())
+
+	switch {
+	case instruction&0xFFF0 == 0x00D0:
+		d.set(ClassDisplay, "SCU", Nibble(instruction.GetN()))
+	case instruction&0xF00F == 0x5002:
+		d.set(ClassMemory, "SAVE", x, y)
+	case instruction&0xF00F == 0x5003:
+		d.set(ClassMemory, "LOAD", x, y)
+	case instruction == 0xF000:
+		d.set(ClassLoad, "LD", Special(OperandI), Addr(readWord(memory, d.Address+2)))
+		d.Size = 4
+	case instruction&0xF0FF == 0xF001:
+		d.set(ClassDisplay, "PLANE", Nibble(instruction.GetX()))
+	case instruction == 0xF002:
+		d.set(ClassSound, "AUDIO")
+	case instruction&0xF0FF == 0xF03A:
+		d.set(ClassSound, "PITCH", x)
+	}
+}
+
+func decodeChip8X(d *Decoded, instruction emulator.Instruction) {
+	x, y := Reg(instruction.GetX()), Reg(instruction.GetY())
+
+	switch {
+	case instruction == 0x02A0:
+		d.set(ClassDisplay, "BGC")
+	case instruction&0xF00F == 0x5001:
+		d.set(ClassArith, "ADDN", x, y)
+	case instruction>>12 == 0xB:
+		// CHIP-8X has no JP V0, Bxyn colours a zone of the screen instead
+		d.set(ClassDisplay, "COL", x, y, Nibble(instruction.GetN()))
+	case instruction&0xF0FF == 0xE0F2:
+		d.setSkip("SKP2", x)
+	case instruction&0xF0FF == 0xE0F5:
+		d.setSkip("SKNP2", x)
+	case instruction&0xF0FF == 0xF0F8:
+		d.set(ClassIO, "OUT", x)
+	case instruction&0xF0FF == 0xF0FB:
+		d.set(ClassIO, "IN", x)
+	}
+}
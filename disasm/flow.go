@@ -0,0 +1,202 @@
+package disasm
+
+import (
+	"sort"
+
+	"github.com/kopi22/chip8/symbols"
+)
+
+// maxJumpTable limits how many entries of a Bnnn jump table are followed.
+const maxJumpTable = 64
+
+// Analysis is the result of following the control flow of a program.
+type Analysis struct {
+	Platform   Platform
+	Memory     []byte
+	Start, End uint16
+	// Code holds every reachable instruction, keyed by address.
+	Code map[uint16]Decoded
+	// Entries are the addresses the analysis started from.
+	Entries []uint16
+	// Indirect holds the guessed targets of each JP V0, nnn instruction.
+	Indirect map[uint16][]uint16
+	// Symbols is the symbol map of the program, if there is one.
+	Symbols *symbols.Map
+}
+
+// Item is one line of a listing: either an instruction or a run of data bytes.
+type Item struct {
+	Address     uint16
+	Instruction *Decoded
+	Data        []byte
+	// Label and Source are filled in from the symbol map.
+	Label  string
+	Source string
+}
+
+// Analyze disassembles memory[start:end] by following jumps, calls and skips
+// from start and from any additional entry points. Bytes that are never
+// reached are treated as data.
+func Analyze(platform Platform, memory []byte, start, end uint16, entries ...uint16) *Analysis {
+	return AnalyzeWithSymbols(platform, memory, start, end, nil, entries...)
+}
+
+// AnalyzeWithSymbols is Analyze helped by the symbol map of the program:
+// every source line outside of data is known to be code, data regions are
+// never decoded, and listings show the labels and source lines.
+func AnalyzeWithSymbols(platform Platform, memory []byte, start, end uint16, syms *symbols.Map, entries ...uint16) *Analysis {
+	a := &Analysis{
+		Platform: platform,
+		Memory:   memory,
+		Start:    start,
+		End:      end,
+		Code:     make(map[uint16]Decoded),
+		Entries:  append([]uint16{start}, entries...),
+		Indirect: make(map[uint16][]uint16),
+		Symbols:  syms,
+	}
+
+	work := append([]uint16(nil), a.Entries...)
+	work = append(work, syms.CodeAddresses()...)
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		for a.inRange(addr) && !syms.IsData(addr) {
+			if _, seen := a.Code[addr]; seen {
+				break
+			}
+			d := Decode(platform, memory, addr)
+			if !d.Valid() || !a.inRange(d.Next()-1) {
+				break
+			}
+			a.Code[addr] = d
+
+			for _, target := range d.Targets {
+				if a.inRange(target) {
+					work = append(work, target)
+				}
+			}
+			if d.Class == ClassIndirect {
+				a.Indirect[addr] = a.jumpTable(d)
+				work = append(work, a.Indirect[addr]...)
+			}
+
+			if !d.FallsThrough() {
+				break
+			}
+			addr = d.Next()
+		}
+	}
+
+	return a
+}
+
+func (a *Analysis) inRange(addr uint16) bool {
+	return addr >= a.Start && addr < a.End
+}
+
+// jumpTable guesses the targets of a JP V0, nnn instruction. When the
+// instruction before it loads V0 with a constant the target is exact.
+// Otherwise nnn is assumed to start a table of JP instructions, which is the
+// usual way Bnnn is used.
+func (a *Analysis) jumpTable(d Decoded) []uint16 {
+	base := d.Operands[1].Value
+
+	if prev, ok := a.Code[d.Address-2]; ok && prev.Opcode>>12 == 0x6 && prev.Opcode.GetX() == 0 {
+		return []uint16{base + uint16(prev.Opcode.GetKK())}
+	}
+
+	var targets []uint16
+	for i := uint16(0); i < maxJumpTable; i++ {
+		entry := base + 2*i
+		if !a.inRange(entry) || Decode(a.Platform, a.Memory, entry).Class != ClassJump {
+			break
+		}
+		targets = append(targets, entry)
+	}
+
+	return targets
+}
+
+// IsCode reports whether addr is the first byte of a reachable instruction.
+func (a *Analysis) IsCode(addr uint16) bool {
+	_, ok := a.Code[addr]
+	return ok
+}
+
+// Instructions returns the reachable instructions in address order.
+func (a *Analysis) Instructions() []Decoded {
+	addrs := make([]int, 0, len(a.Code))
+	for addr := range a.Code {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+
+	decoded := make([]Decoded, len(addrs))
+	for i, addr := range addrs {
+		decoded[i] = a.Code[uint16(addr)]
+	}
+
+	return decoded
+}
+
+// Listing walks the analysed range in address order, grouping unreached
+// bytes into runs of at most bytesPerLine data bytes.
+func (a *Analysis) Listing(bytesPerLine int) []Item {
+	var items []Item
+	for addr := a.Start; addr < a.End; {
+		item := Item{Address: addr}
+		item.Label, _ = a.Symbols.Label(addr)
+		if line, ok := a.Symbols.Source(addr); ok {
+			item.Source = line.String()
+		}
+
+		if d, ok := a.Code[addr]; ok {
+			item.Instruction = &d
+			items = append(items, item)
+			addr += d.Size
+			continue
+		}
+
+		// data runs end at labels and source lines
+		for addr < a.End && !a.IsCode(addr) && len(item.Data) < bytesPerLine {
+			item.Data = append(item.Data, a.Memory[addr])
+			addr++
+			if _, ok := a.Symbols.Label(addr); ok || a.startsLine(addr) {
+				break
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// symbolName returns the label of addr from the symbol map when it can be used
+// as an identifier in generated Octo and DOT output. "main" is kept for the
+// start of the program.
+func (a *Analysis) symbolName(addr uint16) (string, bool) {
+	label, ok := a.Symbols.Label(addr)
+	if !ok || label == "main" && addr != a.Start {
+		return "", false
+	}
+	for i, c := range label {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return label, true
+}
+
+func (a *Analysis) startsLine(addr uint16) bool {
+	if a.Symbols == nil {
+		return false
+	}
+	for _, line := range a.Symbols.Lines {
+		if line.Address == addr {
+			return true
+		}
+	}
+	return false
+}
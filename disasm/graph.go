@@ -0,0 +1,301 @@
+package disasm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type EdgeKind string
+
+const (
+	EdgeFallthrough EdgeKind = "fallthrough"
+	EdgeJump        EdgeKind = "jump"
+	EdgeSkip        EdgeKind = "skip"
+	EdgeIndirect    EdgeKind = "indirect"
+	EdgeCall        EdgeKind = "call"
+	EdgeReturn      EdgeKind = "return" // from a call to the instruction after it
+)
+
+type Edge struct {
+	From uint16   `json:"from"`
+	To   uint16   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+// Block is a basic block: a run of instructions entered only at the top and
+// left only at the bottom.
+type Block struct {
+	Start        uint16    `json:"start"`
+	End          uint16    `json:"end"` // address after the last instruction
+	Instructions []Decoded `json:"-"`
+	Succs        []Edge    `json:"succs"`
+}
+
+type Subroutine struct {
+	Name   string   `json:"name"`
+	Entry  uint16   `json:"entry"`
+	Blocks []uint16 `json:"blocks"`
+	Calls  []uint16 `json:"calls"`
+}
+
+// Graph is the control-flow graph of an analysed program together with its
+// call graph.
+type Graph struct {
+	Blocks      map[uint16]*Block `json:"-"`
+	Subroutines []*Subroutine     `json:"subroutines"`
+}
+
+func BuildGraph(a *Analysis) *Graph {
+	g := &Graph{Blocks: make(map[uint16]*Block)}
+	instructions := a.Instructions()
+
+	// find the leaders: entries, branch targets and the instructions after
+	// anything that ends a block
+	leaders := make(map[uint16]bool)
+	calls := make(map[uint16]bool)
+	for _, entry := range a.Entries {
+		leaders[entry] = true
+	}
+	for _, d := range instructions {
+		for _, target := range d.Targets {
+			leaders[target] = true
+		}
+		for _, target := range a.Indirect[d.Address] {
+			leaders[target] = true
+		}
+		if d.Class == ClassCall {
+			calls[d.Targets[0]] = true
+		}
+		if endsBlock(d) {
+			leaders[d.Next()] = true
+		}
+	}
+
+	var block *Block
+	for _, d := range instructions {
+		if block == nil || leaders[d.Address] || block.End != d.Address {
+			block = &Block{Start: d.Address}
+			g.Blocks[d.Address] = block
+		}
+		block.Instructions = append(block.Instructions, d)
+		block.End = d.Next()
+	}
+	for _, block := range g.Blocks {
+		g.link(a, block)
+	}
+
+	// every call target starts a subroutine; the program entry is "main"
+	entries := []uint16{a.Start}
+	for _, target := range sortedAddresses(calls) {
+		if target != a.Start {
+			entries = append(entries, target)
+		}
+	}
+	for _, entry := range entries {
+		if _, ok := g.Blocks[entry]; ok {
+			name := fmt.Sprintf("sub_%03X", entry)
+			if label, ok := a.symbolName(entry); ok {
+				name = label
+			}
+			if entry == a.Start {
+				name = "main"
+			}
+			g.Subroutines = append(g.Subroutines, g.subroutine(entry, name))
+		}
+	}
+
+	return g
+}
+
+func endsBlock(d Decoded) bool {
+	switch d.Class {
+	case ClassJump, ClassCall, ClassReturn, ClassSkip, ClassIndirect:
+		return true
+	}
+	return false
+}
+
+func (g *Graph) link(a *Analysis, block *Block) {
+	last := block.Instructions[len(block.Instructions)-1]
+	add := func(to uint16, kind EdgeKind) {
+		if _, ok := g.Blocks[to]; ok {
+			block.Succs = append(block.Succs, Edge{From: block.Start, To: to, Kind: kind})
+		}
+	}
+
+	switch last.Class {
+	case ClassJump:
+		add(last.Targets[0], EdgeJump)
+	case ClassSkip:
+		add(last.Next(), EdgeFallthrough)
+		add(last.Targets[0], EdgeSkip)
+	case ClassCall:
+		add(last.Targets[0], EdgeCall)
+		add(last.Next(), EdgeReturn)
+	case ClassIndirect:
+		for _, target := range a.Indirect[last.Address] {
+			add(target, EdgeIndirect)
+		}
+	case ClassReturn:
+	default:
+		add(last.Next(), EdgeFallthrough)
+	}
+}
+
+// subroutine collects the blocks reachable from entry without following calls.
+func (g *Graph) subroutine(entry uint16, name string) *Subroutine {
+	sub := &Subroutine{Name: name, Entry: entry}
+
+	seen := map[uint16]bool{entry: true}
+	calls := make(map[uint16]bool)
+	work := []uint16{entry}
+	for len(work) > 0 {
+		block := g.Blocks[work[len(work)-1]]
+		work = work[:len(work)-1]
+		for _, edge := range block.Succs {
+			if edge.Kind == EdgeCall {
+				calls[edge.To] = true
+				continue
+			}
+			if !seen[edge.To] {
+				seen[edge.To] = true
+				work = append(work, edge.To)
+			}
+		}
+	}
+	sub.Blocks = sortedAddresses(seen)
+	sub.Calls = sortedAddresses(calls)
+
+	return sub
+}
+
+func (g *Graph) Subroutine(name string) *Subroutine {
+	for _, sub := range g.Subroutines {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (g *Graph) subroutineName(entry uint16) string {
+	for _, sub := range g.Subroutines {
+		if sub.Entry == entry {
+			return sub.Name
+		}
+	}
+	return fmt.Sprintf("sub_%03X", entry)
+}
+
+// WriteDOT writes the control-flow graph of each given subroutine as a
+// separate Graphviz digraph.
+func (g *Graph) WriteDOT(w io.Writer, subs ...*Subroutine) error {
+	var sb strings.Builder
+	for _, sub := range subs {
+		fmt.Fprintf(&sb, "digraph %s {\n", sub.Name)
+		sb.WriteString("\tnode [shape=box, fontname=monospace];\n")
+		for _, start := range sub.Blocks {
+			block := g.Blocks[start]
+			var label strings.Builder
+			for _, d := range block.Instructions {
+				fmt.Fprintf(&label, "0x%03X  %s\\l", d.Address, d)
+			}
+			fmt.Fprintf(&sb, "\tb_%03X [label=\"%s\"];\n", start, label.String())
+		}
+		for _, start := range sub.Blocks {
+			for _, edge := range g.Blocks[start].Succs {
+				if edge.Kind == EdgeCall {
+					continue
+				}
+				fmt.Fprintf(&sb, "\tb_%03X -> b_%03X [label=\"%s\"];\n", edge.From, edge.To, edge.Kind)
+			}
+		}
+		sb.WriteString("}\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteCallGraphDOT writes the whole-program call graph as a Graphviz digraph.
+func (g *Graph) WriteCallGraphDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph callgraph {\n")
+	sb.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	for _, sub := range g.Subroutines {
+		fmt.Fprintf(&sb, "\t%s [label=\"%s\\n0x%03X\"];\n", sub.Name, sub.Name, sub.Entry)
+	}
+	for _, sub := range g.Subroutines {
+		for _, callee := range sub.Calls {
+			fmt.Fprintf(&sb, "\t%s -> %s;\n", sub.Name, g.subroutineName(callee))
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type jsonInstruction struct {
+	Address  uint16 `json:"address"`
+	Opcode   string `json:"opcode"`
+	Text     string `json:"text"`
+	Class    Class  `json:"class"`
+	Mnemonic string `json:"mnemonic"`
+}
+
+type jsonBlock struct {
+	*Block
+	Instructions []jsonInstruction `json:"instructions"`
+}
+
+// WriteJSON writes the basic blocks, their edges and the subroutines.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	var blocks []jsonBlock
+	for _, start := range sortedAddresses(g.blockSet()) {
+		block := g.Blocks[start]
+		jb := jsonBlock{Block: block}
+		for _, d := range block.Instructions {
+			jb.Instructions = append(jb.Instructions, jsonInstruction{
+				Address:  d.Address,
+				Opcode:   fmt.Sprintf("%04X", uint16(d.Opcode)),
+				Text:     d.String(),
+				Class:    d.Class,
+				Mnemonic: d.Mnemonic,
+			})
+		}
+		blocks = append(blocks, jb)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Blocks      []jsonBlock   `json:"blocks"`
+		Subroutines []*Subroutine `json:"subroutines"`
+	}{blocks, g.Subroutines})
+}
+
+func (g *Graph) blockSet() map[uint16]bool {
+	set := make(map[uint16]bool)
+	for start := range g.Blocks {
+		set[start] = true
+	}
+	return set
+}
+
+func sortedAddresses(set map[uint16]bool) []uint16 {
+	addrs := make([]int, 0, len(set))
+	for addr := range set {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+
+	sorted := make([]uint16, len(addrs))
+	for i, addr := range addrs {
+		sorted[i] = uint16(addr)
+	}
+	return sorted
+}
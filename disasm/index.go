@@ -0,0 +1,101 @@
+package disasm
+
+// IndexValue is the value of I before an instruction executes.
+type IndexValue struct {
+	Base uint16
+	// Indexed is set when I may have been advanced past Base, by ADD I, Vx
+	// or by a load or store, as when walking through a table.
+	Indexed bool
+}
+
+// indexState is what is known about I at a point of the program.
+type indexState struct {
+	set   bool // false until a path reaching the point has been seen
+	known bool
+	value IndexValue
+}
+
+func (s indexState) meet(other indexState) indexState {
+	switch {
+	case !s.set:
+		return other
+	case !other.set:
+		return s
+	case s.known && other.known && s.value.Base == other.value.Base:
+		s.value.Indexed = s.value.Indexed || other.value.Indexed
+		return s
+	}
+	return indexState{set: true}
+}
+
+// IndexValues works out, for every reachable instruction, the value of I
+// before it executes whenever every path to it loads the same constant.
+// I is assumed unknown at the start of each subroutine and after calls.
+func IndexValues(a *Analysis, g *Graph) map[uint16]IndexValue {
+	unknown := indexState{set: true}
+
+	in := make(map[uint16]indexState)
+	for _, sub := range g.Subroutines {
+		in[sub.Entry] = unknown
+	}
+	for _, entry := range a.Entries {
+		in[entry] = unknown
+	}
+
+	work := sortedAddresses(g.blockSet())
+	for len(work) > 0 {
+		start := work[0]
+		work = work[1:]
+		block := g.Blocks[start]
+
+		state := in[start]
+		for _, d := range block.Instructions {
+			state = indexAfter(d, state)
+		}
+
+		for _, edge := range block.Succs {
+			out := state
+			switch edge.Kind {
+			case EdgeCall:
+				continue
+			case EdgeReturn:
+				out = unknown
+			}
+			merged := in[edge.To].meet(out)
+			if merged != in[edge.To] {
+				in[edge.To] = merged
+				work = append(work, edge.To)
+			}
+		}
+	}
+
+	values := make(map[uint16]IndexValue)
+	for start, block := range g.Blocks {
+		state := in[start]
+		for _, d := range block.Instructions {
+			if state.known {
+				values[d.Address] = state.value
+			}
+			state = indexAfter(d, state)
+		}
+	}
+
+	return values
+}
+
+func indexAfter(d Decoded, state indexState) indexState {
+	if len(d.Operands) != 2 {
+		return state
+	}
+
+	switch first, last := d.Operands[0].Kind, d.Operands[1].Kind; {
+	case first == OperandI && d.Mnemonic == "LD":
+		return indexState{set: true, known: true, value: IndexValue{Base: d.Operands[1].Value}}
+	case first == OperandI || first == OperandIndirectI || last == OperandIndirectI:
+		// ADD I, Vx; Fx55/Fx65 may advance I depending on the quirks
+		state.value.Indexed = true
+	case first == OperandF || first == OperandHF:
+		return indexState{set: true}
+	}
+	return state
+}
@@ -0,0 +1,299 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const octoBytesPerLine = 8
+
+var octoSkips = map[string]string{
+	// Octo's "if ... then" executes the next instruction when the condition
+	// holds, so each skip is written with the opposite condition.
+	"SE":   "!=",
+	"SNE":  "==",
+	"SKP":  "-key",
+	"SKNP": "key",
+}
+
+var octoStatements = map[string]string{
+	"CLS":   "clear",
+	"SCR":   "scroll-right",
+	"SCL":   "scroll-left",
+	"EXIT":  "exit",
+	"LOW":   "lores",
+	"HIGH":  "hires",
+	"AUDIO": "audio",
+}
+
+var octoAluOps = map[string]string{
+	"LD":   ":=",
+	"OR":   "|=",
+	"AND":  "&=",
+	"XOR":  "^=",
+	"ADD":  "+=",
+	"SUB":  "-=",
+	"SHR":  ">>=",
+	"SUBN": "=-",
+	"SHL":  "<<=",
+}
+
+type octoWriter struct {
+	a      *Analysis
+	labels map[uint16]string
+	// sprites marks data addresses loaded into I, which are rendered one byte
+	// per line with a bitmap comment.
+	sprites     map[uint16]bool
+	spriteLines map[uint16]bool
+	out         *bufio.Writer
+}
+
+// WriteOcto writes the analysed program as Octo source. Assembling the
+// output reproduces the original bytes: jump, call and I targets get
+// generated labels, everything unreached is emitted as byte literals.
+func WriteOcto(w io.Writer, a *Analysis) error {
+	ow := &octoWriter{
+		a:       a,
+		labels:  make(map[uint16]string),
+		sprites: make(map[uint16]bool),
+		out:     bufio.NewWriter(w),
+	}
+	ow.assignLabels()
+
+	fmt.Fprintln(ow.out, ": main")
+	for _, item := range ow.listing() {
+		if label, ok := ow.labels[item.Address]; ok && label != "main" {
+			fmt.Fprintf(ow.out, "\n: %s\n", label)
+		}
+
+		if item.Instruction != nil {
+			fmt.Fprintf(ow.out, "\t%-24s # 0x%03X\n", ow.instruction(*item.Instruction), item.Address)
+			continue
+		}
+		if ow.spriteLines[item.Address] {
+			fmt.Fprintf(ow.out, "\t0x%02X # %s\n", item.Data[0], bitmap(item.Data[0]))
+			continue
+		}
+		fmt.Fprintf(ow.out, "\t%s\n", octoBytes(item.Data))
+	}
+
+	return ow.out.Flush()
+}
+
+// assignLabels names every referenced address that starts a line of the
+// listing. References to other addresses stay numeric.
+func (ow *octoWriter) assignLabels() {
+	candidates := make(map[uint16]string)
+	name := func(addr uint16, prefix string) {
+		if _, ok := candidates[addr]; !ok && ow.a.inRange(addr) {
+			candidates[addr] = fmt.Sprintf("%s_%03X", prefix, addr)
+			if label, ok := ow.a.symbolName(addr); ok {
+				candidates[addr] = label
+			}
+		}
+	}
+	if ow.a.Symbols != nil {
+		for _, label := range ow.a.Symbols.Labels {
+			if name, ok := ow.a.symbolName(label.Address); ok && ow.a.inRange(label.Address) {
+				candidates[label.Address] = name
+			}
+		}
+	}
+
+	instructions := ow.a.Instructions()
+	for _, d := range instructions {
+		if d.Class == ClassCall {
+			name(d.Targets[0], "sub")
+		}
+	}
+	for _, d := range instructions {
+		switch {
+		case d.Class == ClassJump:
+			name(d.Targets[0], "label")
+		case d.Class == ClassIndirect:
+			name(d.Operands[1].Value, "table")
+		case d.Mnemonic == "LD" && d.Operands[0].Kind == OperandI:
+			addr := d.Operands[1].Value
+			name(addr, "data")
+			if !ow.a.IsCode(addr) {
+				ow.sprites[addr] = true
+			}
+		}
+	}
+	candidates[ow.a.Start] = "main"
+
+	// data is split at every candidate, so only addresses inside
+	// instructions are left without a line of their own
+	ow.labels = candidates
+	starts := make(map[uint16]bool)
+	for _, item := range ow.listing() {
+		starts[item.Address] = true
+	}
+	for addr := range ow.labels {
+		if !starts[addr] {
+			delete(ow.labels, addr)
+		}
+	}
+}
+
+// listing splits data at labels and renders sprite data a byte at a time.
+func (ow *octoWriter) listing() []Item {
+	a := ow.a
+	var items []Item
+	ow.spriteLines = make(map[uint16]bool)
+	inSprite := false
+	for addr := a.Start; addr < a.End; {
+		if d, ok := a.Code[addr]; ok {
+			items = append(items, Item{Address: addr, Instruction: &d})
+			addr += d.Size
+			inSprite = false
+			continue
+		}
+
+		if _, labelled := ow.labels[addr]; labelled {
+			inSprite = ow.sprites[addr]
+		}
+		perLine := octoBytesPerLine
+		if inSprite {
+			perLine = 1
+		}
+
+		item := Item{Address: addr}
+		ow.spriteLines[addr] = inSprite
+		for addr < a.End && !a.IsCode(addr) && len(item.Data) < perLine {
+			item.Data = append(item.Data, a.Memory[addr])
+			addr++
+			if _, labelled := ow.labels[addr]; labelled {
+				break
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+func (ow *octoWriter) address(addr uint16) string {
+	if label, ok := ow.labels[addr]; ok {
+		return label
+	}
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+func (ow *octoWriter) instruction(d Decoded) string {
+	ops := d.Operands
+	reg := func(i int) string {
+		return fmt.Sprintf("v%x", ops[i].Value)
+	}
+	value := func(i int) string {
+		if ops[i].Kind == OperandRegister || ops[i].Kind == OperandOptionalReg {
+			return reg(i)
+		}
+		return fmt.Sprintf("0x%02X", ops[i].Value)
+	}
+
+	switch d.Class {
+	case ClassSkip:
+		if len(ops) == 1 {
+			return fmt.Sprintf("if %s %s then", reg(0), octoSkips[d.Mnemonic])
+		}
+		return fmt.Sprintf("if %s %s %s then", reg(0), octoSkips[d.Mnemonic], value(1))
+	case ClassJump:
+		return "jump " + ow.address(d.Targets[0])
+	case ClassCall:
+		if label, ok := ow.labels[d.Targets[0]]; ok {
+			return label
+		}
+		return fmt.Sprintf(":call 0x%03X", d.Targets[0])
+	case ClassIndirect:
+		return "jump0 " + ow.address(ops[1].Value)
+	case ClassReturn:
+		return "return"
+	case ClassRandom:
+		return fmt.Sprintf("%s := random %s", reg(0), value(1))
+	}
+
+	if statement, ok := octoStatements[d.Mnemonic]; ok {
+		return statement
+	}
+	switch d.Mnemonic {
+	case "DRW":
+		return fmt.Sprintf("sprite %s %s 0x%X", reg(0), reg(1), ops[2].Value)
+	case "SCD":
+		return fmt.Sprintf("scroll-down %d", ops[0].Value)
+	case "SCU":
+		return fmt.Sprintf("scroll-up %d", ops[0].Value)
+	case "SAVE":
+		return fmt.Sprintf("save %s - %s", reg(0), reg(1))
+	case "LOAD":
+		return fmt.Sprintf("load %s - %s", reg(0), reg(1))
+	case "PLANE":
+		return fmt.Sprintf("plane %d", ops[0].Value)
+	case "PITCH":
+		return "pitch := " + reg(0)
+	}
+	if d.Size == 4 {
+		return "i := long " + ow.address(ops[1].Value)
+	}
+
+	switch {
+	case len(ops) == 2 && ops[0].Kind == OperandRegister && ops[1].Kind == OperandDT:
+		return reg(0) + " := delay"
+	case len(ops) == 2 && ops[0].Kind == OperandRegister && ops[1].Kind == OperandK:
+		return reg(0) + " := key"
+	case len(ops) == 2 && ops[0].Kind == OperandRegister && ops[1].Kind == OperandIndirectI:
+		return "load " + reg(0)
+	case len(ops) == 2 && ops[0].Kind == OperandDT:
+		return "delay := " + reg(1)
+	case len(ops) == 2 && ops[0].Kind == OperandST:
+		return "buzzer := " + reg(1)
+	case len(ops) == 2 && ops[0].Kind == OperandI && d.Mnemonic == "ADD":
+		return "i += " + reg(1)
+	case len(ops) == 2 && ops[0].Kind == OperandI:
+		return "i := " + ow.address(ops[1].Value)
+	case len(ops) == 2 && ops[0].Kind == OperandF:
+		return "i := hex " + reg(1)
+	case len(ops) == 2 && ops[0].Kind == OperandB:
+		return "bcd " + reg(1)
+	case len(ops) == 2 && ops[0].Kind == OperandIndirectI:
+		return "save " + reg(1)
+	case len(ops) == 2 && ops[0].Kind == OperandHF:
+		return "i := bighex " + reg(1)
+	case len(ops) == 2 && ops[0].Kind == OperandR:
+		return "saveflags " + reg(1)
+	case len(ops) == 2 && ops[1].Kind == OperandR:
+		return "loadflags " + reg(0)
+	case len(ops) == 2 && ops[0].Kind == OperandRegister:
+		if op, ok := octoAluOps[d.Mnemonic]; ok {
+			return fmt.Sprintf("%s %s %s", reg(0), op, value(1))
+		}
+	}
+
+	// anything Octo has no statement for is written as raw bytes
+	return fmt.Sprintf("0x%02X 0x%02X", byte(d.Opcode>>8), byte(d.Opcode))
+}
+
+func octoBytes(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("0x%02X", b)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// bitmap draws a sprite row, lit pixels as '#' and unlit as '.'.
+func bitmap(b byte) string {
+	var sb strings.Builder
+	for bit := 7; bit >= 0; bit-- {
+		if b&(1<<uint(bit)) != 0 {
+			sb.WriteByte('#')
+		} else {
+			sb.WriteByte('.')
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package disasm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kopi22/chip8/disasm"
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/octo"
+)
+
+func TestOctoRoundTrip(t *testing.T) {
+	roms, err := filepath.Glob("../roms/*.ch8")
+	if err != nil || len(roms) == 0 {
+		t.Fatalf("no ROMs found: %v", err)
+	}
+
+	for _, rom := range roms {
+		data, err := ioutil.ReadFile(rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		memory := make([]byte, emulator.INITIAL_PC+len(data))
+		copy(memory[emulator.INITIAL_PC:], data)
+		analysis := disasm.Analyze(disasm.PlatformChip8, memory, emulator.INITIAL_PC, uint16(len(memory)))
+
+		var source strings.Builder
+		if err := disasm.WriteOcto(&source, analysis); err != nil {
+			t.Fatal(err)
+		}
+
+		program, err := octo.Compile(rom, source.String())
+		if err != nil {
+			t.Errorf("%s: %v", rom, err)
+			continue
+		}
+		if !bytes.Equal(program.Rom, data) {
+			t.Errorf("%s: recompiled ROM differs", rom)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package disasm
+
+import "fmt"
+
+type OperandKind string
+
+const (
+	OperandRegister    OperandKind = "register"
+	OperandOptionalReg OperandKind = "optionalRegister" // register ignored by some interpreters
+	OperandByte        OperandKind = "byte"
+	OperandNibble      OperandKind = "nibble"
+	OperandAddress     OperandKind = "address"
+	OperandTarget      OperandKind = "target" // address of a jump or call
+	OperandI           OperandKind = "I"
+	OperandIndirectI   OperandKind = "[I]"
+	OperandDT          OperandKind = "DT"
+	OperandST          OperandKind = "ST"
+	OperandK           OperandKind = "K"
+	OperandF           OperandKind = "F"
+	OperandB           OperandKind = "B"
+	OperandHF          OperandKind = "HF"
+	OperandR           OperandKind = "R"
+)
+
+type Operand struct {
+	Kind  OperandKind
+	Value uint16
+}
+
+func Reg(x byte) Operand         { return Operand{OperandRegister, uint16(x)} }
+func OptionalReg(y byte) Operand { return Operand{OperandOptionalReg, uint16(y)} }
+func Byte(kk byte) Operand       { return Operand{OperandByte, uint16(kk)} }
+func Nibble(n byte) Operand      { return Operand{OperandNibble, uint16(n)} }
+func Addr(nnn uint16) Operand    { return Operand{OperandAddress, nnn} }
+func Target(nnn uint16) Operand  { return Operand{OperandTarget, nnn} }
+
+func Special(kind OperandKind) Operand {
+	return Operand{Kind: kind}
+}
+
+func (op Operand) String() string {
+	switch op.Kind {
+	case OperandRegister, OperandOptionalReg:
+		return fmt.Sprintf("V%X", op.Value)
+	case OperandByte:
+		return fmt.Sprintf("$%02X", op.Value)
+	case OperandNibble:
+		return fmt.Sprintf("$%X", op.Value)
+	case OperandAddress:
+		return fmt.Sprintf("$%03X", op.Value)
+	case OperandTarget:
+		return fmt.Sprintf("0x%03X", op.Value)
+	default:
+		return string(op.Kind)
+	}
+}
@@ -0,0 +1,318 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// maxFrames limits how many consecutive frames are taken from a sprite table.
+const maxFrames = 64
+
+type ArtStyle string
+
+const (
+	ArtASCII  ArtStyle = "ascii"
+	ArtBlocks ArtStyle = "blocks"
+)
+
+func ParseArtStyle(name string) (ArtStyle, error) {
+	switch style := ArtStyle(name); style {
+	case ArtASCII, ArtBlocks:
+		return style, nil
+	}
+	return "", fmt.Errorf("unknown art style %q", name)
+}
+
+// Sprite is graphics data drawn by DRW with I loaded from a known address.
+type Sprite struct {
+	Address uint16
+	Width   int // 8, or 16 for SCHIP Dxy0 sprites
+	Height  int
+	// Frames is the number of sprites stored back to back. Sprites drawn
+	// after ADD I, Vx are assumed to be tables that run up to the next
+	// reference, code or the end of the program.
+	Frames  int
+	Data    []byte
+	DrawnAt []uint16
+}
+
+func (s *Sprite) frameSize() int {
+	return s.Height * s.Width / 8
+}
+
+func (s *Sprite) rowSize() int {
+	return s.Width / 8
+}
+
+// FindSprites looks for every address used by a DRW instruction and the
+// height it is drawn with.
+func FindSprites(a *Analysis, g *Graph) []*Sprite {
+	values := IndexValues(a, g)
+	byAddr := make(map[uint16]*Sprite)
+	indexed := make(map[uint16]bool)
+	for _, d := range a.Instructions() {
+		if d.Mnemonic != "DRW" {
+			continue
+		}
+		value, ok := values[d.Address]
+		if !ok {
+			continue
+		}
+
+		width, height := 8, int(d.Opcode.GetN())
+		if height == 0 {
+			if !a.Platform.superChip() {
+				// draws nothing on the original interpreter
+				continue
+			}
+			width, height = 16, 16
+		}
+
+		s := byAddr[value.Base]
+		if s == nil {
+			s = &Sprite{Address: value.Base, Width: width, Frames: 1}
+			byAddr[value.Base] = s
+		}
+		if height > s.Height {
+			s.Height = height
+		}
+		if width > s.Width {
+			s.Width = width
+		}
+		s.DrawnAt = append(s.DrawnAt, d.Address)
+		indexed[value.Base] = indexed[value.Base] || value.Indexed
+	}
+
+	bases := make(map[uint16]bool)
+	for addr := range byAddr {
+		bases[addr] = true
+	}
+
+	var sprites []*Sprite
+	for _, addr := range sortedAddresses(bases) {
+		s := byAddr[addr]
+		if indexed[addr] {
+			limit := int(a.End)
+			for next := int(addr) + 1; next < limit; next++ {
+				if bases[uint16(next)] || a.IsCode(uint16(next)) {
+					limit = next
+				}
+			}
+			if frames := (limit - int(addr)) / s.frameSize(); frames > 1 {
+				s.Frames = frames
+			}
+			if s.Frames > maxFrames {
+				s.Frames = maxFrames
+			}
+		}
+
+		end := int(addr) + s.Frames*s.frameSize()
+		if end > len(a.Memory) {
+			end = len(a.Memory)
+		}
+		if int(addr) < end {
+			s.Data = a.Memory[addr:end]
+		}
+		sprites = append(sprites, s)
+	}
+
+	return sprites
+}
+
+// pixel reports whether the pixel at column c of the given row is lit.
+func (s *Sprite) pixel(row, c int) bool {
+	i := row*s.rowSize() + c/8
+	if i >= len(s.Data) {
+		return false
+	}
+	return s.Data[i]&(0x80>>uint(c%8)) != 0
+}
+
+func (s *Sprite) rows() int {
+	return (len(s.Data) + s.rowSize() - 1) / s.rowSize()
+}
+
+// Art renders every frame of the sprite, one string per line and an empty
+// line between frames. ASCII art uses a line per sprite row; block art packs
+// two rows into each line with half block characters.
+func (s *Sprite) Art(style ArtStyle) []string {
+	var lines []string
+	for first := 0; first < s.rows(); first += s.Height {
+		if first > 0 {
+			lines = append(lines, "")
+		}
+		last := first + s.Height
+		if last > s.rows() {
+			last = s.rows()
+		}
+		lines = append(lines, s.frameArt(first, last, style)...)
+	}
+	return lines
+}
+
+func (s *Sprite) frameArt(first, last int, style ArtStyle) []string {
+	var lines []string
+	if style == ArtASCII {
+		for row := first; row < last; row++ {
+			lines = append(lines, s.asciiRow(row))
+		}
+		return lines
+	}
+
+	for row := first; row < last; row += 2 {
+		var sb strings.Builder
+		for c := 0; c < s.Width; c++ {
+			top, bottom := s.pixel(row, c), row+1 < last && s.pixel(row+1, c)
+			switch {
+			case top && bottom:
+				sb.WriteRune('█')
+			case top:
+				sb.WriteRune('▀')
+			case bottom:
+				sb.WriteRune('▄')
+			default:
+				sb.WriteRune(' ')
+			}
+		}
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+func (s *Sprite) asciiRow(row int) string {
+	var sb strings.Builder
+	for c := 0; c < s.Width; c++ {
+		if s.pixel(row, c) {
+			sb.WriteByte('#')
+		} else {
+			sb.WriteByte('.')
+		}
+	}
+	return sb.String()
+}
+
+// WriteSprites prints each sprite with its art.
+func WriteSprites(w io.Writer, sprites []*Sprite, style ArtStyle) error {
+	out := bufio.NewWriter(w)
+	for _, s := range sprites {
+		fmt.Fprintf(out, "0x%03X  %dx%d", s.Address, s.Width, s.Height)
+		if s.Frames > 1 {
+			fmt.Fprintf(out, " x %d frames", s.Frames)
+		}
+		fmt.Fprintf(out, ", drawn at %s\n", joinAddresses(s.DrawnAt))
+		for _, line := range s.Art(style) {
+			fmt.Fprintf(out, "    %s\n", line)
+		}
+	}
+	return out.Flush()
+}
+
+// WriteSpriteListing prints the analysed listing like WriteListing, but with
+// sprite data one row per line next to its art.
+func WriteSpriteListing(w io.Writer, a *Analysis, sprites []*Sprite, style ArtStyle) error {
+	rowAt := make(map[uint16]*Sprite)
+	for _, s := range sprites {
+		for offset := 0; offset < len(s.Data); offset += s.rowSize() {
+			rowAt[s.Address+uint16(offset)] = s
+		}
+	}
+	inSprite := func(addr uint16) bool {
+		return rowAt[addr] != nil || rowAt[addr-1] != nil && rowAt[addr-1].rowSize() == 2
+	}
+
+	out := bufio.NewWriter(w)
+	for addr := a.Start; addr < a.End; {
+		if d, ok := a.Code[addr]; ok {
+			fmt.Fprintf(out, "0x%03X - %s\n", addr, d)
+			addr += d.Size
+			continue
+		}
+
+		if s := rowAt[addr]; s != nil {
+			// the last row is cut short when the sprite runs off the end of
+			// the ROM
+			offset := int(addr - s.Address)
+			rowEnd := offset + s.rowSize()
+			if rowEnd > len(s.Data) {
+				rowEnd = len(s.Data)
+			}
+			row := Sprite{Width: s.Width, Height: 1, Data: s.Data[offset:rowEnd]}
+			art := row.asciiRow(0)
+			if style == ArtBlocks {
+				art = strings.NewReplacer("#", "█", ".", "·").Replace(art)
+			}
+			fmt.Fprintf(out, "0x%03X - DB %-10s ; %s\n", addr, FormatBytes(row.Data), art)
+			addr += uint16(len(row.Data))
+			continue
+		}
+
+		var data []byte
+		start := addr
+		for addr < a.End && !a.IsCode(addr) && !inSprite(addr) && len(data) < 8 {
+			data = append(data, a.Memory[addr])
+			addr++
+		}
+		fmt.Fprintf(out, "0x%03X - DB %s\n", start, FormatBytes(data))
+	}
+
+	return out.Flush()
+}
+
+// WriteSpriteSheet writes every sprite frame side by side as a PNG, lit pixels
+// white on black, each pixel scaled to a scale x scale square.
+func WriteSpriteSheet(w io.Writer, sprites []*Sprite, scale int) error {
+	if scale < 1 {
+		scale = 1
+	}
+	const gap = 1
+
+	width, height := gap, gap
+	for _, s := range sprites {
+		frames := (s.rows() + s.Height - 1) / s.Height
+		width += frames * (s.Width + gap)
+		if s.Height+2*gap > height {
+			height = s.Height + 2*gap
+		}
+	}
+
+	background := color.RGBA{0x20, 0x20, 0x20, 0xFF}
+	img := image.NewRGBA(image.Rect(0, 0, width*scale, height*scale))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+
+	x := gap
+	for _, s := range sprites {
+		for frame := 0; frame*s.Height < s.rows(); frame++ {
+			for row := 0; row < s.Height; row++ {
+				for c := 0; c < s.Width; c++ {
+					lit := s.pixel(frame*s.Height+row, c)
+					fill := color.RGBA{0, 0, 0, 0xFF}
+					if lit {
+						fill = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+					}
+					for dy := 0; dy < scale; dy++ {
+						for dx := 0; dx < scale; dx++ {
+							img.SetRGBA((x+c)*scale+dx, (gap+row)*scale+dy, fill)
+						}
+					}
+				}
+			}
+			x += s.Width + gap
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+func joinAddresses(addrs []uint16) string {
+	parts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		parts[i] = fmt.Sprintf("0x%03X", addr)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,28 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpriteListingTruncated(t *testing.T) {
+	// LD I, 0x206; DRW V0, V1, 0; JP 0x204; then one byte of a 16x16 sprite
+	rom := []byte{0xA2, 0x06, 0xD0, 0x10, 0x12, 0x04, 0xFF}
+	memory := make([]byte, 0x200+len(rom))
+	copy(memory[0x200:], rom)
+	a := Analyze(PlatformSCHIP, memory, 0x200, uint16(len(memory)))
+
+	sprites := FindSprites(a, BuildGraph(a))
+	if len(sprites) != 1 || sprites[0].Width != 16 || len(sprites[0].Data) != 1 {
+		t.Fatalf("expected one truncated 16x16 sprite, got %+v", sprites)
+	}
+
+	var out strings.Builder
+	if err := WriteSpriteListing(&out, a, sprites, ArtASCII); err != nil {
+		t.Fatal(err)
+	}
+	want := "0x206 - DB $FF        ; ########........\n"
+	if !strings.HasSuffix(out.String(), want) {
+		t.Errorf("listing ends with\n%s\nwant\n%s", out.String(), want)
+	}
+}
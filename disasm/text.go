@@ -0,0 +1,78 @@
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// String renders the instruction in the classic Cowgod mnemonic syntax.
+func (d Decoded) String() string {
+	if !d.Valid() {
+		return fmt.Sprintf("DW $%04X", uint16(d.Opcode))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(d.Mnemonic)
+	for i, op := range d.Operands {
+		switch {
+		case op.Kind == OperandOptionalReg:
+			fmt.Fprintf(&sb, " {, %s}", op)
+		case i == 0:
+			fmt.Fprintf(&sb, " %s", op)
+		default:
+			fmt.Fprintf(&sb, ", %s", op)
+		}
+	}
+
+	return sb.String()
+}
+
+// WriteText prints one instruction per line, prefixed with its address.
+func WriteText(w io.Writer, decoded []Decoded) error {
+	for _, d := range decoded {
+		if _, err := fmt.Fprintf(w, "0x%03X - %s\n", d.Address, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DataBytesPerLine is how many unreached bytes listings put on one DB line.
+const DataBytesPerLine = 8
+
+// WriteListing prints an analysed listing, with data runs shown as DB lines.
+// Labels and source lines from a symbol map are shown around the lines.
+func WriteListing(w io.Writer, items []Item) error {
+	for _, item := range items {
+		if item.Label != "" {
+			if _, err := fmt.Fprintf(w, "%s:\n", item.Label); err != nil {
+				return err
+			}
+		}
+
+		line := fmt.Sprintf("0x%03X - DB %s", item.Address, FormatBytes(item.Data))
+		if item.Instruction != nil {
+			line = fmt.Sprintf("0x%03X - %s", item.Address, item.Instruction)
+		}
+		if item.Source != "" {
+			line = fmt.Sprintf("%-32s ; %s", line, item.Source)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FormatBytes lists data bytes the way DB lines show them, like $12, $34.
+func FormatBytes(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("$%02X", b)
+	}
+
+	return strings.Join(parts, ", ")
+}
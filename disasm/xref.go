@@ -0,0 +1,342 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxStackDepth is the number of return addresses the CHIP-8 stack holds.
+const maxStackDepth = 16
+
+type UsageKind string
+
+const (
+	UsageSprite UsageKind = "sprite"
+	UsageBCD    UsageKind = "bcd"
+	UsageStore  UsageKind = "store" // Fx55 register block
+	UsageLoad   UsageKind = "load"  // Fx65 register block
+)
+
+// Usage is an instruction that accesses memory through a known I.
+type Usage struct {
+	Kind UsageKind
+	At   uint16
+	Size uint16 // number of bytes accessed
+	// Indexed is set when the access may be at an offset from the address.
+	Indexed bool
+}
+
+// XRef collects everything that refers to one address.
+type XRef struct {
+	Address uint16
+	Jumps   []uint16
+	Calls   []uint16
+	LoadsI  []uint16
+	Usages  []Usage
+}
+
+type RoutineSummary struct {
+	Name    string
+	Entry   uint16
+	Reads   uint16 // bit n set when Vn is read
+	Writes  uint16 // bit n set when Vn is written
+	Callees []string
+}
+
+// SelfModification is a store whose target overlaps reachable code.
+type SelfModification struct {
+	At     uint16
+	Target uint16
+}
+
+type Report struct {
+	Refs          []*XRef
+	Routines      []RoutineSummary
+	StackDepth    int  // deepest chain of nested calls from main
+	Recursive     bool // some subroutine can call itself
+	SelfModifying []SelfModification
+	// UnknownStores counts stores through an I the analysis cannot resolve.
+	UnknownStores int
+}
+
+func BuildReport(a *Analysis, g *Graph) *Report {
+	r := &Report{}
+	refs := make(map[uint16]*XRef)
+	ref := func(addr uint16) *XRef {
+		if refs[addr] == nil {
+			refs[addr] = &XRef{Address: addr}
+		}
+		return refs[addr]
+	}
+
+	index := IndexValues(a, g)
+	for _, d := range a.Instructions() {
+		switch {
+		case d.Class == ClassJump:
+			ref(d.Targets[0]).Jumps = append(ref(d.Targets[0]).Jumps, d.Address)
+		case d.Class == ClassCall:
+			ref(d.Targets[0]).Calls = append(ref(d.Targets[0]).Calls, d.Address)
+		case d.Class == ClassIndirect:
+			for _, target := range a.Indirect[d.Address] {
+				ref(target).Jumps = append(ref(target).Jumps, d.Address)
+			}
+		case d.Mnemonic == "LD" && d.Operands[0].Kind == OperandI:
+			target := d.Operands[1].Value
+			ref(target).LoadsI = append(ref(target).LoadsI, d.Address)
+		}
+
+		usage, ok := memoryUsage(d)
+		if !ok {
+			continue
+		}
+		value, known := index[d.Address]
+		target := value.Base
+		usage.Indexed = value.Indexed
+		if !known {
+			if usage.Kind != UsageSprite && usage.Kind != UsageLoad {
+				r.UnknownStores++
+			}
+			continue
+		}
+		ref(target).Usages = append(ref(target).Usages, usage)
+		if usage.Kind == UsageBCD || usage.Kind == UsageStore {
+			for addr := target; addr < target+usage.Size; addr++ {
+				if a.covers(addr) {
+					r.SelfModifying = append(r.SelfModifying, SelfModification{At: d.Address, Target: addr})
+					break
+				}
+			}
+		}
+	}
+
+	for _, addr := range sortedKeys(refs) {
+		r.Refs = append(r.Refs, refs[addr])
+	}
+
+	for _, sub := range g.Subroutines {
+		summary := RoutineSummary{Name: sub.Name, Entry: sub.Entry}
+		for _, start := range sub.Blocks {
+			for _, d := range g.Blocks[start].Instructions {
+				reads, writes := RegisterEffects(d)
+				summary.Reads |= reads
+				summary.Writes |= writes
+			}
+		}
+		for _, callee := range sub.Calls {
+			summary.Callees = append(summary.Callees, g.subroutineName(callee))
+		}
+		r.Routines = append(r.Routines, summary)
+	}
+
+	if len(g.Subroutines) > 0 {
+		r.StackDepth, r.Recursive = g.callDepth(g.Subroutines[0].Entry, map[uint16]bool{})
+	}
+
+	return r
+}
+
+// covers reports whether addr is part of any reachable instruction.
+func (a *Analysis) covers(addr uint16) bool {
+	for start := addr; start+4 > addr && start >= a.Start; start-- {
+		if d, ok := a.Code[start]; ok && addr < d.Next() {
+			return true
+		}
+		if start == 0 {
+			break
+		}
+	}
+	return false
+}
+
+// callDepth returns the deepest chain of calls below entry.
+func (g *Graph) callDepth(entry uint16, active map[uint16]bool) (int, bool) {
+	if active[entry] {
+		return 0, true
+	}
+	active[entry] = true
+	defer delete(active, entry)
+
+	depth, recursive := 0, false
+	for _, sub := range g.Subroutines {
+		if sub.Entry != entry {
+			continue
+		}
+		for _, callee := range sub.Calls {
+			d, rec := g.callDepth(callee, active)
+			if d+1 > depth {
+				depth = d + 1
+			}
+			recursive = recursive || rec
+		}
+	}
+
+	return depth, recursive
+}
+
+func memoryUsage(d Decoded) (Usage, bool) {
+	x := uint16(d.Opcode.GetX())
+	switch {
+	case d.Mnemonic == "DRW":
+		rows := uint16(d.Opcode.GetN())
+		if rows == 0 {
+			// SCHIP 16x16 sprite
+			return Usage{Kind: UsageSprite, At: d.Address, Size: 32}, true
+		}
+		return Usage{Kind: UsageSprite, At: d.Address, Size: rows}, true
+	case len(d.Operands) != 2:
+	case d.Operands[0].Kind == OperandB:
+		return Usage{Kind: UsageBCD, At: d.Address, Size: 3}, true
+	case d.Operands[0].Kind == OperandIndirectI:
+		return Usage{Kind: UsageStore, At: d.Address, Size: x + 1}, true
+	case d.Operands[1].Kind == OperandIndirectI:
+		return Usage{Kind: UsageLoad, At: d.Address, Size: x + 1}, true
+	case d.Mnemonic == "SAVE" || d.Mnemonic == "LOAD":
+		kind := UsageStore
+		if d.Mnemonic == "LOAD" {
+			kind = UsageLoad
+		}
+		first, last := d.Operands[0].Value, d.Operands[1].Value
+		if first > last {
+			first, last = last, first
+		}
+		return Usage{Kind: kind, At: d.Address, Size: last - first + 1}, true
+	}
+	return Usage{}, false
+}
+
+// RegisterEffects returns bit masks of the V registers an instruction reads
+// and writes.
+func RegisterEffects(d Decoded) (reads, writes uint16) {
+	x, y := uint16(1)<<d.Opcode.GetX(), uint16(1)<<d.Opcode.GetY()
+	const vf = uint16(1) << 0xF
+	upTo := func(n byte) uint16 {
+		return uint16(1)<<(n+1) - 1
+	}
+	span := func(a, b byte) uint16 {
+		if a > b {
+			a, b = b, a
+		}
+		return upTo(b) &^ (upTo(a) >> 1)
+	}
+
+	switch op := d.Opcode; {
+	case d.Class == ClassSkip && len(d.Operands) == 2 && d.Operands[1].Kind == OperandRegister:
+		return x | y, 0
+	case d.Class == ClassSkip:
+		return x, 0
+	case d.Class == ClassIndirect:
+		return 1, 0
+	case d.Class == ClassRandom:
+		return 0, x
+	case op>>12 == 0x6:
+		return 0, x
+	case op>>12 == 0x7:
+		return x, x
+	case op>>12 == 0x8 && op&0xF == 0x0:
+		return y, x
+	case op>>12 == 0x8:
+		return x | y, x | vf
+	case d.Mnemonic == "DRW":
+		return x | y, vf
+	case d.Mnemonic == "SAVE":
+		return span(d.Opcode.GetX(), d.Opcode.GetY()), 0
+	case d.Mnemonic == "LOAD":
+		return 0, span(d.Opcode.GetX(), d.Opcode.GetY())
+	case d.Mnemonic == "ADDN":
+		return x | y, x
+	case d.Mnemonic == "COL":
+		return x | y, 0
+	case d.Mnemonic == "IN":
+		return 0, x
+	case len(d.Operands) == 2 && d.Operands[0].Kind == OperandIndirectI:
+		return upTo(d.Opcode.GetX()), 0
+	case len(d.Operands) == 2 && d.Operands[1].Kind == OperandIndirectI:
+		return 0, upTo(d.Opcode.GetX())
+	case len(d.Operands) == 2 && d.Operands[0].Kind == OperandR:
+		return upTo(d.Opcode.GetX()), 0
+	case len(d.Operands) == 2 && d.Operands[1].Kind == OperandR:
+		return 0, upTo(d.Opcode.GetX())
+	case len(d.Operands) == 2 && d.Operands[0].Kind == OperandRegister:
+		// LD Vx, DT and LD Vx, K
+		return 0, x
+	case len(d.Operands) >= 1 && d.Operands[len(d.Operands)-1].Kind == OperandRegister:
+		// LD DT, Vx, ADD I, Vx, PITCH Vx, OUT Vx, ...
+		return x, 0
+	}
+	return 0, 0
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintln(out, "Cross references")
+	for _, ref := range r.Refs {
+		fmt.Fprintf(out, "0x%03X\n", ref.Address)
+		writeAddrList(out, "jumped to from", ref.Jumps)
+		writeAddrList(out, "called from", ref.Calls)
+		writeAddrList(out, "loaded into I at", ref.LoadsI)
+		for _, usage := range ref.Usages {
+			indexed := ""
+			if usage.Indexed {
+				indexed = " (indexed)"
+			}
+			fmt.Fprintf(out, "    %s of %d bytes at 0x%03X%s\n", usage.Kind, usage.Size, usage.At, indexed)
+		}
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Subroutines")
+	for _, routine := range r.Routines {
+		fmt.Fprintf(out, "%-8s 0x%03X  reads %-20s writes %-20s", routine.Name, routine.Entry,
+			registerList(routine.Reads), registerList(routine.Writes))
+		if len(routine.Callees) > 0 {
+			fmt.Fprintf(out, " calls %s", strings.Join(routine.Callees, ", "))
+		}
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintln(out)
+	if r.Recursive {
+		fmt.Fprintln(out, "Stack depth: unbounded, the program is recursive")
+	} else {
+		fmt.Fprintf(out, "Stack depth: %d of %d\n", r.StackDepth, maxStackDepth)
+	}
+	for _, mod := range r.SelfModifying {
+		fmt.Fprintf(out, "Self-modifying code: 0x%03X writes to code at 0x%03X\n", mod.At, mod.Target)
+	}
+	if r.UnknownStores > 0 {
+		fmt.Fprintf(out, "%d stores through an unresolved I may modify code\n", r.UnknownStores)
+	}
+
+	return out.Flush()
+}
+
+func writeAddrList(w io.Writer, title string, addrs []uint16) {
+	if len(addrs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "    %s %s\n", title, joinAddresses(addrs))
+}
+
+func registerList(mask uint16) string {
+	if mask == 0 {
+		return "-"
+	}
+	var regs []string
+	for reg := uint(0); reg < 16; reg++ {
+		if mask&(1<<reg) != 0 {
+			regs = append(regs, fmt.Sprintf("V%X", reg))
+		}
+	}
+	return strings.Join(regs, ",")
+}
+
+func sortedKeys(refs map[uint16]*XRef) []uint16 {
+	set := make(map[uint16]bool, len(refs))
+	for addr := range refs {
+		set[addr] = true
+	}
+	return sortedAddresses(set)
+}
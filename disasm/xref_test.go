@@ -0,0 +1,60 @@
+package disasm
+
+import "testing"
+
+func TestRegisterEffects(t *testing.T) {
+	const (
+		v0 = 1 << iota
+		v1
+		v2
+		v3
+		vf = 1 << 0xF
+	)
+	tests := []struct {
+		platform Platform
+		code     []byte
+		reads    uint16
+		writes   uint16
+	}{
+		{PlatformChip8, []byte{0x00, 0xE0}, 0, 0},             // CLS
+		{PlatformChip8, []byte{0x31, 0x05}, v1, 0},            // SE V1, $05
+		{PlatformChip8, []byte{0x51, 0x20}, v1 | v2, 0},       // SE V1, V2
+		{PlatformChip8, []byte{0x61, 0x05}, 0, v1},            // LD V1, $05
+		{PlatformChip8, []byte{0x71, 0x05}, v1, v1},           // ADD V1, $05
+		{PlatformChip8, []byte{0x81, 0x20}, v2, v1},           // LD V1, V2
+		{PlatformChip8, []byte{0x81, 0x24}, v1 | v2, v1 | vf}, // ADD V1, V2
+		{PlatformChip8, []byte{0xB2, 0x00}, v0, 0},            // JP V0, $200
+		{PlatformChip8, []byte{0xC1, 0xFF}, 0, v1},            // RND V1, $FF
+		{PlatformChip8, []byte{0xD1, 0x25}, v1 | v2, vf},      // DRW V1, V2, 5
+		{PlatformChip8, []byte{0xE1, 0x9E}, v1, 0},            // SKP V1
+		{PlatformChip8, []byte{0xF1, 0x07}, 0, v1},            // LD V1, DT
+		{PlatformChip8, []byte{0xF1, 0x0A}, 0, v1},            // LD V1, K
+		{PlatformChip8, []byte{0xF1, 0x15}, v1, 0},            // LD DT, V1
+		{PlatformChip8, []byte{0xF1, 0x1E}, v1, 0},            // ADD I, V1
+		{PlatformChip8, []byte{0xF2, 0x55}, v0 | v1 | v2, 0},  // LD [I], V2
+		{PlatformChip8, []byte{0xF2, 0x65}, 0, v0 | v1 | v2},  // LD V2, [I]
+		{PlatformSCHIP, []byte{0xF1, 0x75}, v0 | v1, 0},       // LD R, V1
+		{PlatformSCHIP, []byte{0xF1, 0x85}, 0, v0 | v1},       // LD V1, R
+		{PlatformXOChip, []byte{0x53, 0x12}, v1 | v2 | v3, 0}, // SAVE V3, V1
+		{PlatformXOChip, []byte{0x51, 0x33}, 0, v1 | v2 | v3}, // LOAD V1, V3
+		{PlatformXOChip, []byte{0xF2, 0x01}, 0, 0},            // PLANE 2
+		{PlatformXOChip, []byte{0xF1, 0x3A}, v1, 0},           // PITCH V1
+		{PlatformChip8X, []byte{0x51, 0x21}, v1 | v2, v1},     // ADDN V1, V2
+		{PlatformChip8X, []byte{0xB1, 0x23}, v1 | v2, 0},      // COL V1, V2, 3
+		{PlatformChip8X, []byte{0xE1, 0xF2}, v1, 0},           // SKP2 V1
+		{PlatformChip8X, []byte{0xF1, 0xF8}, v1, 0},           // OUT V1
+		{PlatformChip8X, []byte{0xF1, 0xFB}, 0, v1},           // IN V1
+	}
+
+	for _, test := range tests {
+		memory := make([]byte, 0x200+len(test.code))
+		copy(memory[0x200:], test.code)
+		d := Decode(test.platform, memory, 0x200)
+
+		reads, writes := RegisterEffects(d)
+		if reads != test.reads || writes != test.writes {
+			t.Errorf("%s %s: reads %s writes %s, want reads %s writes %s", test.platform, d,
+				registerList(reads), registerList(writes), registerList(test.reads), registerList(test.writes))
+		}
+	}
+}
@@ -1,200 +1,84 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
-)
-
-type Instruction uint16
+	"os"
+	"strconv"
+	"strings"
 
-func (instruction Instruction) getNNN() uint16 {
-	return uint16(instruction & 0x0FFF)
-}
+	"github.com/kopi22/chip8/disasm"
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/symbols"
+)
 
-func (instruction Instruction) getY() byte {
-	return byte((instruction & 0x00F0) >> 4)
-}
+// addressList is a flag holding comma separated addresses, e.g. 0x2A0,0x300.
+type addressList []uint16
 
-func (instruction Instruction) getX() byte {
-	return byte((instruction & 0x0F00) >> 8)
+func (list *addressList) String() string {
+	parts := make([]string, len(*list))
+	for i, addr := range *list {
+		parts[i] = fmt.Sprintf("0x%03X", addr)
+	}
+	return strings.Join(parts, ",")
 }
 
-func (instruction Instruction) getKK() byte {
-	return byte(instruction & 0x00FF)
+func (list *addressList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		addr, err := strconv.ParseUint(strings.TrimSpace(part), 0, 12)
+		if err != nil {
+			return fmt.Errorf("invalid address %q", part)
+		}
+		*list = append(*list, uint16(addr))
+	}
+	return nil
 }
 
-func (instruction Instruction) getN() byte {
-	return byte(instruction & 0x000F)
-}
+func main() {
+	var entries addressList
+	linear := flag.Bool("linear", false, "decode every 2 bytes instead of following the control flow")
+	format := flag.String("format", "text", "output format: text, octo, cfg, callgraph, json, xref or sprites")
+	subName := flag.String("sub", "", "only graph the named subroutine (cfg format)")
+	platformName := flag.String("platform", string(disasm.PlatformChip8), "instruction set: chip8, schip, xochip or chip8x")
+	showSprites := flag.Bool("sprites", false, "draw sprite data next to the text listing")
+	art := flag.String("art", string(disasm.ArtBlocks), "sprite art style: ascii or blocks")
+	sheet := flag.String("sheet", "", "write the sprites found to this PNG file")
+	scale := flag.Int("scale", 4, "pixel size of the PNG sprite sheet")
+	symbolFile := flag.String("sym", "", "symbol map of the ROM, by default the ROM name with a .sym extension if there is one")
+	flag.Var(&entries, "entry", "additional code entry points, comma separated")
+	flag.Parse()
 
-func DisassembleInstruction(codeBuffer []byte, pc int) {
-	// instructions must be at even locations in the TEXT segment
-	if pc%2 == 1 {
-		fmt.Printf("Not-aligned PC! (%04X)\n", pc)
+	platform, err := disasm.ParsePlatform(*platformName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	artStyle, err := disasm.ParseArtStyle(*art)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	fmt.Printf("0x%03X - ", pc)
-
-	instruction := Instruction((uint16(codeBuffer[pc]) << 8) | uint16(codeBuffer[pc+1]))
-	// first NIBBLE determines the instruction type
-	switch instruction >> 12 {
-	case 0x0:
-		switch uint16(instruction) {
-		case 0x00E0:
-			fmt.Printf("CLS")
-		case 0x00EE:
-			fmt.Printf("RET")
-		default:
-			// SYS addr - not implemented (skip)
-			fmt.Printf("NOP")
-		}
-	case 0x1:
-		addr := instruction.getNNN()
-		fmt.Printf("JP 0x%03X", addr)
-	case 0x2:
-		addr := instruction.getNNN()
-		fmt.Printf("CALL 0x%03X", addr)
-	case 0x3:
-		reg := instruction.getX()
-		val := instruction.getKK()
-		fmt.Printf("SE V%X, $%02X", reg, val)
-	case 0x4:
-		reg := instruction.getX()
-		val := instruction.getKK()
-		fmt.Printf("SNE V%X, $%02X", reg, val)
-	case 0x5:
-		switch instruction & 0x000F {
-		case 0x0:
-			regX := instruction.getX()
-			regY := instruction.getY()
-			fmt.Printf("SE V%X, V%X", regX, regY)
-		default:
-			fmt.Printf("Instruction %04X not yet implemented", instruction)
-		}
-	case 0x6:
-		dst := instruction.getX()
-		val := instruction.getKK()
-		fmt.Printf("LD V%X, $%02X", dst, val)
-	case 0x7:
-		dst := instruction.getX()
-		val := instruction.getKK()
-		fmt.Printf("ADD V%X, $%02X", dst, val)
-	case 0x8:
-		switch instruction & 0x000F {
-		case 0x0:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("LD V%X, V%X", dst, src)
-		case 0x1:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("OR V%X, V%X", dst, src)
-		case 0x2:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("AND V%X, V%X", dst, src)
-		case 0x3:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("XOR V%X, V%X", dst, src)
-		case 0x4:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("ADD V%X, V%X", dst, src)
-		case 0x5:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("SUB V%X, V%X", dst, src)
-		case 0x6:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("SHR V%X {, V%X}", dst, src)
-		case 0x7:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("SUBN V%X, V%X", dst, src)
-		case 0xe:
-			dst := instruction.getX()
-			src := instruction.getY()
-			fmt.Printf("SHL V%X {, V%X}", dst, src)
-		default:
-			fmt.Printf("Instruction %04X not yet implemented", instruction)
-		}
-	case 0x9:
-		switch instruction & 0x000F {
-		case 0x0:
-			regX := instruction.getX()
-			regY := instruction.getY()
-			fmt.Printf("SNE V%X, V%X", regX, regY)
-		default:
-			fmt.Printf("Instruction %04X not yet implemented", instruction)
-		}
-	case 0xa:
-		addr := instruction.getNNN()
-		fmt.Printf("LD I, $%03X", addr)
-	case 0xb:
-		addr := instruction.getNNN()
-		fmt.Printf("JP V0, $%03X", addr)
-	case 0xc:
-		dst := instruction.getX()
-		val := instruction.getKK()
-		fmt.Printf("RND V%X, $%02X", dst, val)
-	case 0xd:
-		x := instruction.getX()
-		y := instruction.getY()
-		n := instruction.getN()
-		fmt.Printf("DRW V%X, V%X, $%X", x, y, n)
-	case 0xe:
-		switch instruction & 0x00FF {
-		case 0x9e:
-			reg := instruction.getX()
-			fmt.Printf("SKP V%X", reg)
-		case 0xA1:
-			reg := instruction.getX()
-			fmt.Printf("SKNP V%X", reg)
-		default:
-			fmt.Printf("Instruction %04X not yet implemented", instruction)
-		}
-	case 0xf:
-		switch instruction & 0xFF {
-		case 0x07:
-			dst := instruction.getX()
-			fmt.Printf("LD V%X, DT", dst)
-		case 0x0A:
-			dst := instruction.getX()
-			fmt.Printf("LD V%X, K", dst)
-		case 0x15:
-			src := instruction.getX()
-			fmt.Printf("LD DT, V%X", src)
-		case 0x18:
-			src := instruction.getX()
-			fmt.Printf("LD ST, V%X", src)
-		case 0x1e:
-			reg := instruction.getX()
-			fmt.Printf("ADD I, V%X", reg)
-		case 0x29:
-			reg := instruction.getX()
-			fmt.Printf("LD F, V%X", reg)
-		case 0x33:
-			reg := instruction.getX()
-			fmt.Printf("LD B, V%X", reg)
-		case 0x55:
-			reg := instruction.getX()
-			fmt.Printf("LD [I], V%X", reg)
-		case 0x65:
-			reg := instruction.getX()
-			fmt.Printf("LD V%X, [I]", reg)
-		default:
-			fmt.Printf("Instruction %04X not yet implemented", instruction)
-		}
+	switch *format {
+	case "text", "octo", "cfg", "callgraph", "json", "xref", "sprites":
 	default:
-		fmt.Printf("Instruction %04X not yet implemented", instruction)
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if *linear && (*format != "text" || *showSprites) {
+		fmt.Fprintln(os.Stderr, "-linear only applies to the text format without -sprites")
+		os.Exit(2)
+	}
+	if *subName != "" && *format != "cfg" {
+		fmt.Fprintln(os.Stderr, "-sub only applies to the cfg format")
+		os.Exit(2)
 	}
-	fmt.Println()
-}
 
-func main() {
 	sourcecodeFilename := "roms/Sierpinski.ch8"
+	if flag.NArg() > 0 {
+		sourcecodeFilename = flag.Arg(0)
+	}
 
 	// read CHIP-8 instructions
 	sourcecode, err := ioutil.ReadFile(sourcecodeFilename)
@@ -204,10 +88,72 @@ func main() {
 	}
 
 	// instructions start at 0x200
-	TEXT := make([]byte, 0x200+len(sourcecode))
-	copy(TEXT[0x200:], sourcecode)
+	TEXT := make([]byte, emulator.INITIAL_PC+len(sourcecode))
+	copy(TEXT[emulator.INITIAL_PC:], sourcecode)
+	end := uint16(len(TEXT))
+
+	syms, err := symbols.ReadForROM(*symbolFile, sourcecodeFilename)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	analysis := disasm.AnalyzeWithSymbols(platform, TEXT, emulator.INITIAL_PC, end, syms, entries...)
+
+	if *sheet != "" {
+		if err := writeSpriteSheet(*sheet, analysis, *scale); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	switch {
+	case *format == "octo":
+		err = disasm.WriteOcto(os.Stdout, analysis)
+	case *format == "cfg":
+		graph := disasm.BuildGraph(analysis)
+		subs := graph.Subroutines
+		if *subName != "" {
+			sub := graph.Subroutine(*subName)
+			if sub == nil {
+				fmt.Fprintf(os.Stderr, "no subroutine named %q\n", *subName)
+				os.Exit(2)
+			}
+			subs = []*disasm.Subroutine{sub}
+		}
+		err = graph.WriteDOT(os.Stdout, subs...)
+	case *format == "callgraph":
+		err = disasm.BuildGraph(analysis).WriteCallGraphDOT(os.Stdout)
+	case *format == "json":
+		err = disasm.BuildGraph(analysis).WriteJSON(os.Stdout)
+	case *format == "sprites":
+		sprites := disasm.FindSprites(analysis, disasm.BuildGraph(analysis))
+		err = disasm.WriteSprites(os.Stdout, sprites, artStyle)
+	case *format == "xref":
+		err = disasm.BuildReport(analysis, disasm.BuildGraph(analysis)).WriteText(os.Stdout)
+	case *showSprites:
+		sprites := disasm.FindSprites(analysis, disasm.BuildGraph(analysis))
+		err = disasm.WriteSpriteListing(os.Stdout, analysis, sprites, artStyle)
+	case *linear:
+		err = disasm.WriteText(os.Stdout, disasm.Disassemble(platform, TEXT, emulator.INITIAL_PC, end))
+	default:
+		err = disasm.WriteListing(os.Stdout, analysis.Listing(disasm.DataBytesPerLine))
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func writeSpriteSheet(filename string, analysis *disasm.Analysis, scale int) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	for pc := 0x200; pc < len(TEXT); pc += 2 {
-		DisassembleInstruction(TEXT, pc)
+	sprites := disasm.FindSprites(analysis, disasm.BuildGraph(analysis))
+	if err := disasm.WriteSpriteSheet(file, sprites, scale); err != nil {
+		return err
 	}
+	return file.Close()
 }
@@ -0,0 +1,102 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/gif"
+
+	"github.com/kopi22/chip8/emulator/io"
+)
+
+var gifMagic = []byte("GIF8")
+
+// Cartridge is a program shared as an Octo GIF cartridge.
+type Cartridge struct {
+	Program string           `json:"program"`
+	Options CartridgeOptions `json:"options"`
+}
+
+// CartridgeOptions holds the Octo settings stored in a cartridge.
+type CartridgeOptions struct {
+	TickRate        int    `json:"tickrate"`
+	BackgroundColor string `json:"backgroundColor"`
+	FillColor       string `json:"fillColor"`
+	FillColor2      string `json:"fillColor2"`
+	BlendColor      string `json:"blendColor"`
+	BuzzColor       string `json:"buzzColor"`
+	QuietColor      string `json:"quietColor"`
+	ShiftQuirks     bool   `json:"shiftQuirks"`
+	LoadStoreQuirks bool   `json:"loadStoreQuirks"`
+	JumpQuirks      bool   `json:"jumpQuirks"`
+	LogicQuirks     bool   `json:"logicQuirks"`
+	ClipQuirks      bool   `json:"clipQuirks"`
+	VBlankQuirks    bool   `json:"vBlankQuirks"`
+	MaxSize         int    `json:"maxSize"`
+	ScreenRotation  int    `json:"screenRotation"`
+	FontStyle       string `json:"fontStyle"`
+}
+
+func IsCartridge(data []byte) bool {
+	return bytes.HasPrefix(data, gifMagic)
+}
+
+// DecodeCartridge extracts the payload hidden in an Octo cartridge.
+//
+// The low two bits of every pixel's palette index carry two bits of payload,
+// most significant first, continuing across all frames of the GIF. The first
+// four payload bytes are the big-endian length of the JSON document that
+// follows.
+func DecodeCartridge(data []byte) (*Cartridge, error) {
+	image, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	var current byte
+	pairs := 0
+	for _, frame := range image.Image {
+		for _, index := range frame.Pix {
+			current = current<<2 | index&0x3
+			pairs++
+			if pairs == 4 {
+				payload = append(payload, current)
+				current, pairs = 0, 0
+			}
+		}
+	}
+
+	if len(payload) < 4 {
+		return nil, errors.New("cartridge holds no payload")
+	}
+	size := int(payload[0])<<24 | int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+	if size < 0 || size > len(payload)-4 {
+		return nil, fmt.Errorf("cartridge payload length %d exceeds image data", size)
+	}
+
+	cartridge := &Cartridge{}
+	if err := json.Unmarshal(payload[4:4+size], cartridge); err != nil {
+		return nil, fmt.Errorf("invalid cartridge payload: %v", err)
+	}
+
+	return cartridge, nil
+}
+
+func (options CartridgeOptions) Quirks() Quirks {
+	return Quirks{
+		Shift:     options.ShiftQuirks,
+		LoadStore: options.LoadStoreQuirks,
+		Jump:      options.JumpQuirks,
+		VFReset:   options.LogicQuirks,
+		Clip:      options.ClipQuirks,
+		VBlank:    options.VBlankQuirks,
+	}
+}
+
+// Palette returns the display colours of the cartridge. Colours that are
+// missing or malformed are reported as an error.
+func (options CartridgeOptions) Palette() (io.Palette, error) {
+	return io.ParsePalette(options.BackgroundColor, options.FillColor, options.FillColor2, options.BlendColor)
+}
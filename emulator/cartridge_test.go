@@ -0,0 +1,113 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encodeCartridge hides payload in a GIF the way Octo does, in the low two bits
+// of every pixel, using frames of size x size pixels. The high bits of the
+// pixels are set too, to check that they are ignored.
+func encodeCartridge(t *testing.T, payload []byte, size int) []byte {
+	var pairs []byte
+	for _, b := range payload {
+		for shift := 6; shift >= 0; shift -= 2 {
+			pairs = append(pairs, b>>uint(shift)&0x3)
+		}
+	}
+
+	palette := make(color.Palette, 8)
+	for i := range palette {
+		palette[i] = color.Gray{Y: uint8(i * 32)}
+	}
+	anim := &gif.GIF{}
+	for len(pairs) > 0 || len(anim.Image) == 0 {
+		frame := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+		for i := range frame.Pix {
+			frame.Pix[i] = 4
+			if i < len(pairs) {
+				frame.Pix[i] |= pairs[i]
+			}
+		}
+		if len(pairs) > len(frame.Pix) {
+			pairs = pairs[len(frame.Pix):]
+		} else {
+			pairs = nil
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 0)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func withLength(document []byte) []byte {
+	n := len(document)
+	return append([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, document...)
+}
+
+func TestDecodeCartridge(t *testing.T) {
+	want := &Cartridge{
+		Program: ": main\n  clear\n  loop again\n",
+		Options: CartridgeOptions{
+			TickRate:        20,
+			BackgroundColor: "#000000",
+			FillColor:       "#FF0000",
+			ShiftQuirks:     true,
+			ClipQuirks:      true,
+		},
+	}
+	document, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 16x16 frames hold 64 bytes, so the payload spans several of them
+	data := encodeCartridge(t, withLength(document), 16)
+	if !IsCartridge(data) {
+		t.Fatal("the GIF is not recognised as a cartridge")
+	}
+	cartridge, err := DecodeCartridge(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cartridge, want) {
+		t.Errorf("decoded %+v, want %+v", cartridge, want)
+	}
+	if quirks := cartridge.Options.Quirks(); !quirks.Shift || !quirks.Clip || quirks.LoadStore {
+		t.Errorf("quirks %+v, want shift and clip", quirks)
+	}
+}
+
+func TestDecodeCartridgeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		size    int
+		err     string
+	}{
+		{"no payload", nil, 1, "cartridge holds no payload"},
+		{"too long", []byte{0, 0, 1, 0, '{', '}'}, 4, "cartridge payload length 256 exceeds image data"},
+		{"not JSON", withLength([]byte("program")), 4, "invalid cartridge payload"},
+	}
+
+	for _, test := range tests {
+		_, err := DecodeCartridge(encodeCartridge(t, test.payload, test.size))
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%s: error %v, want %s", test.name, err, test.err)
+		}
+	}
+	if IsCartridge([]byte{0x00, 0xE0}) {
+		t.Error("a ROM is recognised as a cartridge")
+	}
+}
@@ -0,0 +1,83 @@
+package emulator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kopi22/chip8/emulator/io"
+	"github.com/kopi22/chip8/emulator/romdb"
+)
+
+// applyRomDatabase configures the emulator with the settings the ROM
+// database knows for the program, if any.
+func (emu *Emulator) applyRomDatabase(rom []byte) {
+	db, err := romdb.Default()
+	if err != nil {
+		emu.notify("ROM database: %v", err)
+	}
+	if db == nil {
+		return
+	}
+
+	entry, ok := db.Lookup(rom)
+	if !ok {
+		return
+	}
+	emu.romEntry = entry
+
+	applied := []string{fmt.Sprintf("%q", entry.Program.Title)}
+	if len(entry.Program.Authors) > 0 {
+		applied = append(applied, "by "+strings.Join(entry.Program.Authors, ", "))
+	}
+
+	if entry.Platform != nil {
+		emu.SetQuirks(quirksFromDatabase(entry.Quirks))
+		applied = append(applied, "platform "+entry.Platform.Name)
+	}
+	if entry.Tickrate > 0 {
+		emu.SetTickRate(entry.Tickrate)
+		applied = append(applied, fmt.Sprintf("tick rate %d", entry.Tickrate))
+	}
+	if colors := entry.Rom.Colors; colors != nil {
+		if palette, err := io.ParsePalette(colors.Pixels...); err == nil {
+			emu.SetPalette(palette)
+			applied = append(applied, "colours "+strings.Join(colors.Pixels, " "))
+		}
+	}
+	if keys := formatKeyHints(entry.Rom.Keys); keys != "" {
+		applied = append(applied, "keys "+keys)
+	}
+
+	emu.notify("ROM database: %s", strings.Join(applied, "; "))
+}
+
+func quirksFromDatabase(quirks map[string]bool) Quirks {
+	return Quirks{
+		Shift:     quirks["shift"],
+		LoadStore: quirks["memoryLeaveIUnchanged"],
+		IncrByX:   quirks["memoryIncrementByX"],
+		Jump:      quirks["jump"],
+		VFReset:   quirks["logic"],
+		Clip:      !quirks["wrap"],
+		VBlank:    quirks["vblank"],
+	}
+}
+
+// formatKeyHints lists the game actions with the keyboard keys they are
+// mapped to.
+func formatKeyHints(keys map[string]int) string {
+	var hints []string
+	for action, chipKey := range keys {
+		hint := fmt.Sprintf("%s=%X", action, chipKey)
+		for r, key := range io.DefaultKeyboardMap {
+			if key == io.Key(1<<uint(chipKey)) {
+				hint = fmt.Sprintf("%s=%c", action, r)
+			}
+		}
+		hints = append(hints, hint)
+	}
+	sort.Strings(hints)
+
+	return strings.Join(hints, " ")
+}
@@ -0,0 +1,74 @@
+package emulator
+
+import (
+	"github.com/kopi22/chip8/symbols"
+)
+
+// DebugInfo is a snapshot of the machine for a debugger to show.
+type DebugInfo struct {
+	State       State
+	Paused      bool
+	Breakpoints map[uint16]bool
+	Symbols     *symbols.Map
+}
+
+// DebugView is an IO that shows the state of the machine. ShowDebug is called
+// every frame and after every debugger command, with a copy the view may
+// keep.
+type DebugView interface {
+	ShowDebug(info DebugInfo)
+}
+
+// SetPaused stops or resumes the execution of instructions.
+func (emu *Emulator) SetPaused(paused bool) *Emulator {
+	if emu.paused && !paused {
+		// do not stop again at the breakpoint execution resumes from
+		emu.resumed = true
+	}
+	emu.paused = paused
+	return emu
+}
+
+// ToggleBreakpoint sets or clears a breakpoint, which pauses execution before
+// the instruction at addr runs.
+func (emu *Emulator) ToggleBreakpoint(addr uint16) {
+	if emu.breakpoints == nil {
+		emu.breakpoints = make(map[uint16]bool)
+	}
+	if emu.breakpoints[addr] {
+		delete(emu.breakpoints, addr)
+	} else {
+		emu.breakpoints[addr] = true
+	}
+}
+
+// atBreakpoint reports whether execution should stop before the instruction
+// at PC.
+func (emu *Emulator) atBreakpoint() bool {
+	resumed := emu.resumed
+	emu.resumed = false
+	return !resumed && emu.breakpoints[emu.chipState.PC]
+}
+
+// showDebug sends a snapshot of the machine to the IO, if it can show one.
+func (emu *Emulator) showDebug() {
+	view, ok := emu.io.(DebugView)
+	if !ok {
+		return
+	}
+
+	state := *emu.chipState
+	state.Memory = append([]byte(nil), emu.chipState.Memory...)
+	state.FrameBuf = frameBuffer(state.Memory)
+	breakpoints := make(map[uint16]bool, len(emu.breakpoints))
+	for addr := range emu.breakpoints {
+		breakpoints[addr] = true
+	}
+
+	view.ShowDebug(DebugInfo{
+		State:       state,
+		Paused:      emu.paused,
+		Breakpoints: breakpoints,
+		Symbols:     emu.symbols,
+	})
+}
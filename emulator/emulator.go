@@ -1,10 +1,16 @@
 package emulator
 
 import (
+	"fmt"
 	"github.com/kopi22/chip8/emulator/io"
+	"github.com/kopi22/chip8/emulator/romdb"
+	"github.com/kopi22/chip8/octo"
+	"github.com/kopi22/chip8/symbols"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"strings"
 	"time"
 )
 
@@ -16,17 +22,142 @@ const SpriteWidth = 8
 const DefaultEmuSpeed = 2 * time.Millisecond
 const TimerPeriod = 17 * time.Millisecond
 
+// OctoExtension marks ROMs given as Octo source, compiled when loaded.
+const OctoExtension = ".8o"
+
+// SymbolsExtension replaces the extension of a ROM to name its symbol map.
+const SymbolsExtension = symbols.Extension
+
 type Emulator struct {
 	chipState *State
 	io        io.IO
+	cpuPeriod time.Duration
+	palette   io.Palette
+	romEntry  *romdb.Entry
+	symbols   *symbols.Map
+
+	// palettes are cycled through by the NextPalette event
+	palettes     []io.NamedPalette
+	paletteIndex int
+
+	romPath     string
+	romModTime  time.Time
+	programSize int
+	hotReload   bool
+	stateFile   string
+
+	observers []Observer
+	exitHooks []func()
+
+	// paused stops the CPU and the timers for the debugger, and resumed lets
+	// the instruction at a breakpoint run once execution continues.
+	paused      bool
+	resumed     bool
+	breakpoints map[uint16]bool
+
+	rates rates
+
+	screenshotScale   int
+	screenshotPalette io.Palette
+
+	// recording, if set, gets the display every frame
+	recording          frameWriter
+	recordingExtension string
+
+	waitingForVBlank bool
+}
+
+// Observer is told about every instruction before Step executes it, with
+// the PC of the state pointing at the instruction.
+type Observer interface {
+	BeforeExecute(state *State, instruction Instruction)
 }
 
 func NewEmulator() *Emulator {
 	return &Emulator{
-		chipState: InitChipState(),
+		chipState:       InitChipState(),
+		cpuPeriod:       DefaultEmuSpeed,
+		screenshotScale: DefaultScreenshotScale,
 	}
 }
 
+func (emu *Emulator) SetQuirks(quirks Quirks) *Emulator {
+	emu.chipState.Quirks = quirks
+	return emu
+}
+
+// SetTickRate sets the number of instructions executed per timer tick.
+func (emu *Emulator) SetTickRate(tickRate int) *Emulator {
+	if tickRate > 0 {
+		emu.cpuPeriod = TimerPeriod / time.Duration(tickRate)
+	}
+	return emu
+}
+
+// CPUPeriod returns the time between two instructions.
+func (emu *Emulator) CPUPeriod() time.Duration {
+	return emu.cpuPeriod
+}
+
+func (emu *Emulator) SetPalette(palette io.Palette) *Emulator {
+	emu.palette = palette
+	if colorable, ok := emu.io.(io.Colorable); ok {
+		colorable.SetPalette(palette)
+	}
+	return emu
+}
+
+// SetPalettes sets the palettes the NextPalette event cycles through.
+func (emu *Emulator) SetPalettes(palettes []io.NamedPalette) *Emulator {
+	emu.palettes = palettes
+	emu.paletteIndex = -1
+	return emu
+}
+
+// SelectPalette switches to the named palette of those set by SetPalettes.
+func (emu *Emulator) SelectPalette(name string) error {
+	for i, p := range emu.palettes {
+		if p.Name == name {
+			emu.paletteIndex = i
+			emu.SetPalette(p.Palette)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown palette %q", name)
+}
+
+// nextPalette switches to the palette after the one last chosen.
+func (emu *Emulator) nextPalette() {
+	if len(emu.palettes) == 0 {
+		return
+	}
+	emu.paletteIndex = (emu.paletteIndex + 1) % len(emu.palettes)
+	emu.SetPalette(emu.palettes[emu.paletteIndex].Palette)
+}
+
+// SetSymbols sets the symbol map of the loaded program, used to show labels
+// and source lines instead of addresses.
+func (emu *Emulator) SetSymbols(symbols *symbols.Map) *Emulator {
+	emu.symbols = symbols
+	return emu
+}
+
+func (emu *Emulator) Symbols() *symbols.Map {
+	return emu.symbols
+}
+
+func (emu *Emulator) AddObserver(observer Observer) *Emulator {
+	emu.observers = append(emu.observers, observer)
+	return emu
+}
+
+// AtExit registers a function run when the emulator quits, after the IO is
+// shut down.
+func (emu *Emulator) AtExit(hook func()) *Emulator {
+	emu.exitHooks = append(emu.exitHooks, hook)
+	return emu
+}
+
 func (emu *Emulator) ConnectIO(io io.IO) *Emulator {
 	// detach current IO
 	if emu.io != nil {
@@ -37,6 +168,9 @@ func (emu *Emulator) ConnectIO(io io.IO) *Emulator {
 	// initialize new IO
 	emu.io = io
 	emu.io.Init()
+	if emu.palette != nil {
+		emu.SetPalette(emu.palette)
+	}
 
 	return emu
 }
@@ -48,36 +182,107 @@ func (emu *Emulator) Launch(romFilename string) {
 	go emu.io.FetchInputEvents(inputChan)
 
 	timerTicker := time.NewTicker(TimerPeriod)
-	cpuTicker := time.NewTicker(DefaultEmuSpeed)
+	cpuTicker := time.NewTicker(emu.cpuPeriod)
+
+	// a nil channel never fires, so nothing is polled without hot reload
+	var reloadChan <-chan time.Time
+	if emu.hotReload {
+		reloadChan = time.NewTicker(ReloadPollPeriod).C
+	}
 
 	for {
 		select {
 		case <-cpuTicker.C:
+			if emu.paused || emu.waitingForVBlank {
+				break
+			}
+			if emu.atBreakpoint() {
+				emu.paused = true
+				emu.showDebug()
+				break
+			}
 			emu.Step()
-			// Update screen
-			emu.io.Draw(emu.chipState.FrameBuf)
 		case <-timerTicker.C:
-			if emu.chipState.Delay > 0 {
-				emu.chipState.Delay -= 1
-			}
-			if emu.chipState.Sound > 0 {
-				emu.chipState.Sound -= 1
+			// Update screen
+			emu.present()
+			emu.recordFrame()
+			emu.rates.tick(time.Now())
+			emu.showStatus()
+			emu.showDebug()
+			if emu.paused {
+				break
 			}
+			emu.tickTimers()
 		case ev := <-inputChan:
 			emu.handleInputEvent(ev)
+		case <-reloadChan:
+			if emu.romChanged() {
+				emu.reload()
+			}
+		}
+	}
+}
+
+// tickTimers ends the frame, counting the timers down.
+func (emu *Emulator) tickTimers() {
+	emu.waitingForVBlank = false
+	if emu.chipState.Delay > 0 {
+		emu.chipState.Delay -= 1
+	}
+	if emu.chipState.Sound > 0 {
+		emu.chipState.Sound -= 1
+	}
+}
+
+// RunFrames runs the program for a number of frames without IO, as fast as
+// it can, with the instructions per frame of the tick rate. It runs ROMs
+// headlessly, for instance to take screenshots in batch.
+func (emu *Emulator) RunFrames(frames int) {
+	perFrame := int(TimerPeriod / emu.cpuPeriod)
+	for frame := 0; frame < frames; frame++ {
+		for i := 0; i < perFrame && !emu.waitingForVBlank; i++ {
+			emu.Step()
 		}
+		emu.recordFrame()
+		emu.tickTimers()
 	}
 }
 
 func (emu *Emulator) exit(exitCode int) {
-	emu.io.Fini()
+	emu.shutdown()
 	os.Exit(exitCode)
 }
 
+// exitWithError logs the error once the IO is shut down, so it is left on
+// the terminal.
 func (emu *Emulator) exitWithError(exitCode int, err error) {
+	emu.shutdown()
 	log.Printf("%+v", err)
-	emu.exit(exitCode)
+	os.Exit(exitCode)
+}
 
+// shutdown finishes the IO, then the recording, and runs the exit hooks.
+func (emu *Emulator) shutdown() {
+	if emu.io != nil {
+		emu.io.Fini()
+	}
+	if err := emu.StopRecording(); err != nil {
+		log.Printf("recording: %v", err)
+	}
+	for _, hook := range emu.exitHooks {
+		hook()
+	}
+}
+
+// notify shows a message through the IO, or logs it if the IO cannot show
+// it, as when running without one.
+func (emu *Emulator) notify(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if notifier, ok := emu.io.(io.Notifier); ok {
+		notifier.Notify(message)
+		return
+	}
+	log.Print(message)
 }
 
 func (emu *Emulator) handleInputEvent(event io.InputEvent) {
@@ -90,28 +295,162 @@ func (emu *Emulator) handleInputEvent(event io.InputEvent) {
 		}
 	case io.Quit:
 		emu.exit(0)
+	case io.SaveState:
+		if err := emu.SaveState(emu.statePath()); err != nil {
+			emu.notify("save state: %v", err)
+		} else {
+			emu.notify("saved state to %s", emu.statePath())
+		}
+	case io.LoadState:
+		if err := emu.LoadState(emu.statePath()); err != nil {
+			emu.notify("load state: %v", err)
+		} else {
+			emu.notify("loaded state from %s", emu.statePath())
+		}
+	case io.NextPalette:
+		emu.nextPalette()
+		emu.chipState.markAllRows()
+	case io.Screenshot:
+		emu.takeScreenshot()
+	case io.ToggleRecording:
+		emu.toggleRecording()
+	case io.TogglePause:
+		emu.SetPaused(!emu.paused)
+		emu.showDebug()
+	case io.StepInstruction:
+		emu.paused = true
+		emu.Step()
+		emu.present()
+		emu.showDebug()
+	case io.ToggleBreakpoint:
+		emu.ToggleBreakpoint(event.Address)
+		emu.showDebug()
+	}
+}
+
+// present shows the rows of the display changed since the last frame, at
+// most once per timer tick.
+func (emu *Emulator) present() {
+	rows := emu.chipState.takeDirtyRows()
+	if len(rows) == 0 {
+		return
 	}
+
+	emu.rates.frames++
+	if display, ok := emu.io.(io.RowDisplay); ok && len(rows) < DisplayHeight {
+		display.DrawRows(emu.chipState.FrameBuf, rows)
+		return
+	}
+	emu.io.Draw(emu.chipState.FrameBuf)
 }
 
 func (emu *Emulator) LoadRom(filename string) {
-	// read CHIP-8 instructions
 	filepath := "roms/" + filename
-	sourcecode, err := ioutil.ReadFile(filepath)
+	program, err := emu.readProgram(filepath)
 	if err != nil {
 		emu.exitWithError(1, err)
 	}
 
-	copy(emu.chipState.Memory[INITIAL_PC:], sourcecode)
+	emu.romPath = filepath
+	if info, err := os.Stat(filepath); err == nil {
+		emu.romModTime = info.ModTime()
+	}
+	emu.loadProgram(program)
+	emu.chipState.markAllRows()
+}
+
+// readProgram reads a ROM, an Octo cartridge or Octo source, configures the
+// emulator for it and returns the program bytes.
+func (emu *Emulator) readProgram(filepath string) ([]byte, error) {
+	// read CHIP-8 instructions
+	sourcecode, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case IsCartridge(sourcecode):
+		sourcecode, err = emu.loadCartridge(filepath, sourcecode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath, err)
+		}
+	case strings.HasSuffix(filepath, OctoExtension):
+		return emu.compileOcto(filepath, string(sourcecode))
+	default:
+		emu.applyRomDatabase(sourcecode)
+		emu.loadSymbols(filepath)
+	}
+	return sourcecode, nil
+}
+
+// loadProgram copies the program to memory, clearing what is left of a
+// longer program loaded before.
+func (emu *Emulator) loadProgram(program []byte) {
+	memory := emu.chipState.Memory[INITIAL_PC:]
+	for i := copy(memory, program); i < emu.programSize && i < len(memory); i++ {
+		memory[i] = 0
+	}
+	emu.programSize = len(program)
+}
+
+// loadCartridge configures the emulator with the options of an Octo cartridge
+// and returns the program it contains.
+func (emu *Emulator) loadCartridge(filename string, data []byte) ([]byte, error) {
+	cartridge, err := DecodeCartridge(data)
+	if err != nil {
+		return nil, err
+	}
+
+	options := cartridge.Options
+	emu.SetQuirks(options.Quirks())
+	emu.SetTickRate(options.TickRate)
+	if palette, err := options.Palette(); err == nil {
+		emu.SetPalette(palette)
+	}
+
+	return emu.compileOcto(filename, cartridge.Program)
+}
+
+// compileOcto turns Octo source into ROM bytes, keeping its symbols.
+func (emu *Emulator) compileOcto(filename, source string) ([]byte, error) {
+	program, err := octo.Compile(filename, source)
+	if err != nil {
+		return nil, err
+	}
+	emu.symbols = program.Symbols
+	return program.Rom, nil
+}
+
+// loadSymbols reads the symbol map written by the assembler next to a ROM,
+// if there is one. The map of the program loaded before is dropped either way.
+func (emu *Emulator) loadSymbols(romPath string) {
+	emu.symbols = nil
+	symPath := strings.TrimSuffix(romPath, path.Ext(romPath)) + SymbolsExtension
+	syms, err := symbols.ReadFile(symPath)
+	switch {
+	case err == nil:
+		emu.symbols = syms
+	case !os.IsNotExist(err):
+		emu.notify("%s: %v", symPath, err)
+	}
 }
 
 func (emu *Emulator) Step() {
 	// fetch instruction from Memory
 	instruction := FetchInstruction(emu.chipState.Memory, emu.chipState.PC)
+	for _, observer := range emu.observers {
+		observer.BeforeExecute(emu.chipState, instruction)
+	}
 
 	// increase program counter
 	emu.chipState.PC += 2
+	emu.rates.instructions++
 
 	emu.executeInstruction(instruction)
+
+	if instruction>>12 == 0xD && emu.chipState.Quirks.VBlank {
+		emu.waitingForVBlank = true
+	}
 }
 
 func (emu *Emulator) executeInstruction(instruction Instruction) {
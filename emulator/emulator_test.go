@@ -0,0 +1,36 @@
+package emulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSymbols(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	romPath := filepath.Join(dir, "game.ch8")
+	symPath := filepath.Join(dir, "game"+SymbolsExtension)
+
+	if err := ioutil.WriteFile(symPath, []byte("label 0x200 main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emu := NewEmulator()
+	emu.loadSymbols(romPath)
+	if label, ok := emu.Symbols().Label(0x200); !ok || label != "main" {
+		t.Fatalf("label at 0x200 is %q, want main", label)
+	}
+
+	// reloading after the map is deleted must not keep the old one
+	if err := os.Remove(symPath); err != nil {
+		t.Fatal(err)
+	}
+	emu.loadSymbols(romPath)
+	if emu.Symbols() != nil {
+		t.Errorf("symbols %+v are kept after the map is deleted", emu.Symbols())
+	}
+}
@@ -18,6 +18,7 @@ func Op0(chipState *State, instruction Instruction) {
 		for i := range chipState.FrameBuf {
 			chipState.FrameBuf[i] = 0
 		}
+		chipState.markAllRows()
 
 	case 0x00EE: // RET
 		chipState.SP--
@@ -81,14 +82,17 @@ func Op8(chipState *State, instruction Instruction) {
 	case 0x1:
 		// OR Vx, Vy
 		chipState.V[instruction.GetX()] |= chipState.V[instruction.GetY()]
+		resetVF(chipState)
 
 	case 0x2:
 		// AND Vx, Vy
 		chipState.V[instruction.GetX()] &= chipState.V[instruction.GetY()]
+		resetVF(chipState)
 
 	case 0x3:
 		// XOR Vx, Vy
 		chipState.V[instruction.GetX()] ^= chipState.V[instruction.GetY()]
+		resetVF(chipState)
 
 	case 0x4:
 		// ADD Vx, Vy
@@ -116,10 +120,11 @@ func Op8(chipState *State, instruction Instruction) {
 	case 0x6:
 		// SHR Vx {, Vy}
 		vx := &chipState.V[instruction.GetX()]
+		src := shiftSource(chipState, instruction)
 
-		chipState.V[0xF] = 0x1 & (*vx)
+		chipState.V[0xF] = 0x1 & src
 
-		*vx >>= 1
+		*vx = src >> 1
 
 	case 0x7:
 		// SUBN Vx, Vy
@@ -137,16 +142,32 @@ func Op8(chipState *State, instruction Instruction) {
 	case 0xe:
 		// SHL Vx {, Vy}
 		vx := &chipState.V[instruction.GetX()]
+		src := shiftSource(chipState, instruction)
 
-		chipState.V[0xF] = (0x80 & (*vx)) >> 7
+		chipState.V[0xF] = (0x80 & src) >> 7
 
-		*vx <<= 1
+		*vx = src << 1
 
 	default:
 		UnsupportedInstruction(instruction)
 	}
 }
 
+// resetVF clears VF after a logical operation when the VF reset quirk is on.
+func resetVF(chipState *State) {
+	if chipState.Quirks.VFReset {
+		chipState.V[0xF] = 0
+	}
+}
+
+// shiftSource returns the register value shifted by 8xy6 and 8xyE.
+func shiftSource(chipState *State, instruction Instruction) byte {
+	if chipState.Quirks.Shift {
+		return chipState.V[instruction.GetX()]
+	}
+	return chipState.V[instruction.GetY()]
+}
+
 func Op9(chipState *State, instruction Instruction) {
 	//  SE Vx, Vy
 	if chipState.V[instruction.GetX()] != chipState.V[instruction.GetY()] {
@@ -161,7 +182,11 @@ func OpA(chipState *State, instruction Instruction) {
 
 func OpB(chipState *State, instruction Instruction) {
 	// JP V0, addr
-	chipState.PC = uint16(chipState.V[0]) + instruction.GetNNN()
+	offsetReg := byte(0)
+	if chipState.Quirks.Jump {
+		offsetReg = instruction.GetX()
+	}
+	chipState.PC = uint16(chipState.V[offsetReg]) + instruction.GetNNN()
 }
 
 func OpC(chipState *State, instruction Instruction) {
@@ -177,6 +202,10 @@ func OpD(chipState *State, instruction Instruction) {
 
 	bytesToRead := int(instruction.GetN())
 	initX, initY := int(chipState.V[instruction.GetX()]), int(chipState.V[instruction.GetY()])
+	if chipState.Quirks.Clip {
+		// only the starting position wraps, the rest of the sprite is clipped
+		initX, initY = initX%DisplayWidth, initY%DisplayHeight
+	}
 
 	sprite := chipState.Memory[chipState.I : chipState.I+uint16(bytesToRead)]
 
@@ -184,6 +213,10 @@ func OpD(chipState *State, instruction Instruction) {
 		for c := 0; c < SpriteWidth; c++ {
 			// draw only if sprite bit is 1
 			if sprite[r]&(0x80>>c) != 0 {
+				if chipState.Quirks.Clip && (c+initX >= DisplayWidth || r+initY >= DisplayHeight) {
+					continue
+				}
+
 				// position of the pixel on the screen (with wrap-around)
 				x, y := (c+initX)%DisplayWidth, (r+initY)%DisplayHeight
 
@@ -194,6 +227,7 @@ func OpD(chipState *State, instruction Instruction) {
 				pixelMask := byte(0x80 >> bitOffset)
 
 				chipState.FrameBuf[byteOffset] ^= pixelMask
+				chipState.markRow(y)
 
 				// mark collision if display pixel is OFF
 				if chipState.FrameBuf[byteOffset]&pixelMask == 0 {
@@ -270,6 +304,7 @@ func OpF(chipState *State, instruction Instruction) {
 		chipState.Memory[chipState.I] = digits[0] - 0x30
 		chipState.Memory[chipState.I+1] = digits[1] - 0x30
 		chipState.Memory[chipState.I+2] = digits[2] - 0x30
+		chipState.markMemory(chipState.I, 3)
 
 	case 0x55:
 		lastRegToStore := uint16(instruction.GetX())
@@ -277,6 +312,8 @@ func OpF(chipState *State, instruction Instruction) {
 		for i := uint16(0); i <= lastRegToStore; i++ {
 			chipState.Memory[chipState.I+i] = chipState.V[i]
 		}
+		chipState.markMemory(chipState.I, int(lastRegToStore)+1)
+		advanceI(chipState, lastRegToStore)
 
 	case 0x65:
 		lastRegToLoad := uint16(instruction.GetX())
@@ -284,8 +321,20 @@ func OpF(chipState *State, instruction Instruction) {
 		for i := uint16(0); i <= lastRegToLoad; i++ {
 			chipState.V[i] = chipState.Memory[chipState.I+i]
 		}
+		advanceI(chipState, lastRegToLoad)
 
 	default:
 		UnsupportedInstruction(instruction)
 	}
 }
+
+// advanceI moves I past the registers stored or loaded by Fx55/Fx65.
+func advanceI(chipState *State, lastReg uint16) {
+	switch {
+	case chipState.Quirks.LoadStore:
+	case chipState.Quirks.IncrByX:
+		chipState.I += lastReg
+	default:
+		chipState.I += lastReg + 1
+	}
+}
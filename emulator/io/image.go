@@ -0,0 +1,38 @@
+package io
+
+import (
+	"image"
+	"image/color"
+)
+
+// FrameImage draws a frame buffer of width x height pixels as an image, every
+// pixel a scale x scale square in the background or lit colour of the
+// palette. Without a palette the first builtin one is used.
+func FrameImage(frameBuffer []byte, width, height, scale int, palette Palette) *image.Paletted {
+	if len(palette) < 2 {
+		palette = BuiltinPalettes[0].Palette
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale),
+		color.Palette{palette[0], palette[1]})
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := y*width + x
+			if frameBuffer[offset/8]&(0x80>>(offset%8)) == 0 {
+				continue
+			}
+			// index 0, the background, is the zero value of the image
+			for row := y * scale; row < (y+1)*scale; row++ {
+				start := img.PixOffset(x*scale, row)
+				for i := start; i < start+scale; i++ {
+					img.Pix[i] = 1
+				}
+			}
+		}
+	}
+
+	return img
+}
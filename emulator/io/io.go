@@ -12,6 +12,18 @@ type Display interface {
 	Clear()
 }
 
+// RowDisplay is a Display that can redraw only the rows of the frame buffer
+// that changed.
+type RowDisplay interface {
+	DrawRows(frameBuffer []byte, rows []int)
+}
+
+// Notifier is an IO that can show the user a short message, like the outcome
+// of a key press.
+type Notifier interface {
+	Notify(message string)
+}
+
 type Keyboard interface {
 	FetchInputEvents(chan<- InputEvent)
 }
@@ -29,6 +41,20 @@ const (
 	KeyDown EventType = "KeyDown"
 	KeyUp   EventType = "KeyUp"
 	Quit    EventType = "Quit"
+	// SaveState and LoadState write and restore a snapshot of the machine.
+	SaveState EventType = "SaveState"
+	LoadState EventType = "LoadState"
+	// NextPalette switches to the next of the palettes to cycle through.
+	NextPalette EventType = "NextPalette"
+	// Screenshot saves the display as an image.
+	Screenshot EventType = "Screenshot"
+	// ToggleRecording starts or stops recording the display.
+	ToggleRecording EventType = "ToggleRecording"
+	// TogglePause, StepInstruction and ToggleBreakpoint drive the debugger.
+	// ToggleBreakpoint sets or clears the breakpoint at the event's Address.
+	TogglePause      EventType = "TogglePause"
+	StepInstruction  EventType = "StepInstruction"
+	ToggleBreakpoint EventType = "ToggleBreakpoint"
 )
 
 type Key uint16
@@ -55,4 +81,5 @@ const (
 type InputEvent struct {
 	EventType EventType
 	EventKey  Key
+	Address   uint16
 }
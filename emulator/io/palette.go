@@ -0,0 +1,85 @@
+package io
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Palette lists the display colours: the background first, followed by the
+// colour of lit pixels. XO-CHIP palettes add the second plane colour and the
+// colour of pixels lit on both planes.
+type Palette []color.RGBA
+
+type Colorable interface {
+	SetPalette(Palette)
+}
+
+type NamedPalette struct {
+	Name    string
+	Palette Palette
+}
+
+// BuiltinPalettes are the palettes that come with the emulator, the first of
+// them being the default.
+var BuiltinPalettes = []NamedPalette{
+	{"classic", mustParsePalette("#000000", "#FFFFFF", "#AAAAAA", "#555555")},
+	{"green", mustParsePalette("#0A140A", "#33FF66", "#1F9F3F", "#145A28")},
+	{"amber", mustParsePalette("#140C00", "#FFB000", "#B36B00", "#5C3A00")},
+	{"lcd", mustParsePalette("#9BBC0F", "#0F380F", "#306230", "#8BAC0F")},
+	{"octo", mustParsePalette("#996600", "#FFCC00", "#FF6600", "#662200")},
+	{"highcontrast", mustParsePalette("#000000", "#FFFF00", "#00FFFF", "#FFFFFF")},
+}
+
+// FindPalette returns the palette with the given name.
+func FindPalette(palettes []NamedPalette, name string) (Palette, bool) {
+	for _, p := range palettes {
+		if p.Name == name {
+			return p.Palette, true
+		}
+	}
+	return nil, false
+}
+
+// ParsePalette parses a palette of #RRGGBB colours. It needs at least the
+// background and the colour of lit pixels.
+func ParsePalette(colors ...string) (Palette, error) {
+	if len(colors) < 2 {
+		return nil, fmt.Errorf("a palette needs at least 2 colours, got %d", len(colors))
+	}
+
+	var palette Palette
+	for _, s := range colors {
+		c, err := ParseColor(s)
+		if err != nil {
+			return nil, err
+		}
+		palette = append(palette, c)
+	}
+
+	return palette, nil
+}
+
+func mustParsePalette(colors ...string) Palette {
+	palette, err := ParsePalette(colors...)
+	if err != nil {
+		panic(err)
+	}
+	return palette
+}
+
+// ParseColor parses a colour in the #RRGGBB notation used by Octo.
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+
+	return color.RGBA{R: byte(v >> 16), G: byte(v >> 8), B: byte(v), A: 0xFF}, nil
+}
@@ -0,0 +1,86 @@
+package io
+
+// minLevel is the brightness below which a fading pixel goes dark.
+const minLevel = 1.0 / 32
+
+// Phosphor simulates the persistence of a CRT phosphor, hiding the flicker of
+// sprites erased and redrawn with XOR. Pixels light up at once and fade once
+// they are off, either gradually or after staying off for a number of frames.
+type Phosphor struct {
+	decay  float64 // brightness kept each frame
+	hold   int     // frames a pixel stays lit once it is off
+	levels []float64
+	off    []int // frames each pixel has been off
+}
+
+// NewPhosphorDecay makes pixels lose 1-decay of their brightness every frame.
+func NewPhosphorDecay(decay float64) *Phosphor {
+	return &Phosphor{decay: decay}
+}
+
+// NewPhosphorHold keeps pixels lit until they have been off for frames frames.
+func NewPhosphorHold(frames int) *Phosphor {
+	return &Phosphor{hold: frames}
+}
+
+func (p *Phosphor) resize(frameBuffer []byte) {
+	if len(p.levels) != len(frameBuffer)*8 {
+		p.levels = make([]float64, len(frameBuffer)*8)
+		p.off = make([]int, len(frameBuffer)*8)
+	}
+}
+
+func lit(frameBuffer []byte, i int) bool {
+	return frameBuffer[i/8]&(0x80>>uint(i%8)) != 0
+}
+
+// Light sets the pixels lit in the frame buffer to full brightness.
+func (p *Phosphor) Light(frameBuffer []byte) {
+	p.resize(frameBuffer)
+	for i := range p.levels {
+		if lit(frameBuffer, i) {
+			p.levels[i] = 1
+			p.off[i] = 0
+		}
+	}
+}
+
+// Advance moves on by one frame, fading the pixels that are off in the frame
+// buffer. It reports whether any brightness changed.
+func (p *Phosphor) Advance(frameBuffer []byte) bool {
+	p.resize(frameBuffer)
+	changed := false
+	for i, level := range p.levels {
+		if lit(frameBuffer, i) {
+			changed = changed || level != 1
+			p.levels[i] = 1
+			p.off[i] = 0
+			continue
+		}
+		if level == 0 {
+			continue
+		}
+
+		p.off[i]++
+		switch {
+		case p.decay > 0:
+			level *= p.decay
+		case p.off[i] > p.hold:
+			level = 0
+		}
+		if level < minLevel {
+			level = 0
+		}
+		changed = changed || level != p.levels[i]
+		p.levels[i] = level
+	}
+	return changed
+}
+
+// Level returns the brightness of the i-th pixel, from 0 to 1.
+func (p *Phosphor) Level(i int) float64 {
+	if i >= len(p.levels) {
+		return 0
+	}
+	return p.levels[i]
+}
@@ -0,0 +1,289 @@
+package tcellIO
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kopi22/chip8/disasm"
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/emulator/io"
+)
+
+const (
+	// debugPanelWidth is the width of the column of panels right of the
+	// display, and memoryPanelMinHeight the least height of the memory view
+	// below it.
+	debugPanelWidth      = 40
+	memoryPanelMinHeight = 8
+	debugMinCols         = 80
+	debugMinRows         = 24
+
+	registersPanelHeight = 7
+	stackPanelWidth      = 24
+	stackPanelHeight     = 10
+)
+
+// keypadLayout is the COSMAC VIP keypad.
+var keypadLayout = [4][4]byte{
+	{0x1, 0x2, 0x3, 0xC},
+	{0x4, 0x5, 0x6, 0xD},
+	{0x7, 0x8, 0x9, 0xE},
+	{0xA, 0x0, 0xB, 0xF},
+}
+
+// SetDebugger shows the debugger panels next to the display. F12 shows and
+// hides them while running.
+func (tcellIO *IO) SetDebugger(enabled bool) {
+	tcellIO.debugging = enabled
+}
+
+func (tcellIO *IO) ShowDebug(info emulator.DebugInfo) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	tcellIO.debug = &info
+	if !tcellIO.cursorMoved {
+		tcellIO.cursor = info.State.PC
+	}
+	switch {
+	case tcellIO.scale == 0:
+	case tcellIO.debugging:
+		tcellIO.drawDebug()
+		tcellIO.Screen.Show()
+	case tcellIO.keypadShown:
+		tcellIO.drawKeypadButtons(tcellIO.keypadX, tcellIO.keypadY)
+		tcellIO.Screen.Show()
+	}
+}
+
+// toggleDebugger shows or hides the panels, laying the screen out again.
+func (tcellIO *IO) toggleDebugger() {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	tcellIO.debugging = !tcellIO.debugging
+	tcellIO.enableMouse()
+	tcellIO.layout()
+	if tcellIO.lastFrame != nil {
+		tcellIO.drawFrame(tcellIO.lastFrame)
+	}
+	tcellIO.Screen.Show()
+}
+
+// debugKey handles the keys of the debugger, returning the event to send to
+// the emulator, if any.
+func (tcellIO *IO) debugKey(ev *tcell.EventKey) (io.InputEvent, bool) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	_, screenRows := tcellIO.size()
+	page := 2 * (screenRows - registersPanelHeight - stackPanelHeight - 2)
+	move := 0
+	switch ev.Key() {
+	case tcell.KeyF6:
+		tcellIO.cursorMoved = false
+		return io.InputEvent{EventType: io.TogglePause}, true
+	case tcell.KeyF7:
+		tcellIO.cursorMoved = false
+		return io.InputEvent{EventType: io.StepInstruction}, true
+	case tcell.KeyF8:
+		return io.InputEvent{EventType: io.ToggleBreakpoint, Address: tcellIO.cursor}, true
+	case tcell.KeyUp:
+		move = -2
+	case tcell.KeyDown:
+		move = 2
+	case tcell.KeyPgUp:
+		move = -page
+	case tcell.KeyPgDn:
+		move = page
+	default:
+		return io.InputEvent{}, false
+	}
+
+	cursor := int(tcellIO.cursor) + move
+	if cursor < 0 || cursor >= 0x1000 {
+		return io.InputEvent{}, false
+	}
+	tcellIO.cursor = uint16(cursor)
+	tcellIO.cursorMoved = true
+	if tcellIO.scale > 0 {
+		tcellIO.drawDebug()
+		tcellIO.Screen.Show()
+	}
+	return io.InputEvent{}, false
+}
+
+// drawDebug draws the panels around the display.
+func (tcellIO *IO) drawDebug() {
+	screenCols, screenRows := tcellIO.size()
+	x := screenCols - debugPanelWidth
+	_, rows := tcellIO.rendering.cells(emulator.DisplayWidth*tcellIO.scale, emulator.DisplayHeight*tcellIO.scale)
+	memoryY := tcellIO.originY + rows + 2
+
+	status := "running"
+	if tcellIO.debug != nil && tcellIO.debug.Paused {
+		status = "paused"
+	}
+	tcellIO.drawRegisters(x, 0, debugPanelWidth, registersPanelHeight, "Registers, "+status)
+	tcellIO.drawStack(x, registersPanelHeight, stackPanelWidth, stackPanelHeight)
+	tcellIO.drawKeypad(x+stackPanelWidth, registersPanelHeight, debugPanelWidth-stackPanelWidth, stackPanelHeight)
+	tcellIO.drawDisassembly(x, registersPanelHeight+stackPanelHeight, debugPanelWidth, screenRows-registersPanelHeight-stackPanelHeight)
+	tcellIO.drawMemory(0, memoryY, x, screenRows-memoryY)
+}
+
+// drawPanel draws a titled box and returns the style of its contents.
+func (tcellIO *IO) drawPanel(x, y, width, height int, title string) tcell.Style {
+	drawBox(tcellIO.Screen, x, y, x+width-1, y+height-1, tcellIO.borderStyle())
+	drawText(tcellIO.Screen, x+2, y, width-4, " "+title+" ", tcellIO.borderStyle())
+	return getDefaultDisplayStyle()
+}
+
+// drawText writes text from x, y, cut to width cells.
+func drawText(s tcell.Screen, x, y, width int, text string, style tcell.Style) {
+	for i, ch := range []rune(text) {
+		if i >= width {
+			return
+		}
+		s.SetContent(x+i, y, ch, nil, style)
+	}
+}
+
+func (tcellIO *IO) drawRegisters(x, y, width, height int, title string) {
+	style := tcellIO.drawPanel(x, y, width, height, title)
+	if tcellIO.debug == nil {
+		return
+	}
+
+	state := &tcellIO.debug.State
+	drawText(tcellIO.Screen, x+2, y+1, width-4, fmt.Sprintf("PC %03X  I %03X  SP %X  DT %02X  ST %02X",
+		state.PC, state.I, state.SP, state.Delay, state.Sound), style)
+	for row := 0; row < 4; row++ {
+		line := ""
+		for col := 0; col < 4; col++ {
+			reg := row*4 + col
+			line += fmt.Sprintf("V%X %02X    ", reg, state.V[reg])
+		}
+		drawText(tcellIO.Screen, x+2, y+2+row, width-4, line, style)
+	}
+}
+
+// drawStack lists the return addresses, the innermost call first, with the
+// routine making the call when there is a symbol map.
+func (tcellIO *IO) drawStack(x, y, width, height int) {
+	style := tcellIO.drawPanel(x, y, width, height, "Stack")
+	if tcellIO.debug == nil {
+		return
+	}
+
+	state := &tcellIO.debug.State
+	if state.SP == 0 {
+		drawText(tcellIO.Screen, x+2, y+1, width-4, "empty", style)
+	}
+	for i, line := int(state.SP)-1, 0; i >= 0 && i < len(state.Stack) && line < height-2; i, line = i-1, line+1 {
+		text := fmt.Sprintf("%X %03X", i, state.Stack[i])
+		if tcellIO.debug.Symbols != nil {
+			text += " " + tcellIO.debug.Symbols.Describe(state.Stack[i]-2)
+		}
+		drawText(tcellIO.Screen, x+2, y+1+line, width-4, text, style)
+	}
+}
+
+// drawKeypad shows the keypad with the pressed keys highlighted, where they
+// can be clicked.
+func (tcellIO *IO) drawKeypad(x, y, width, height int) {
+	style := tcellIO.drawPanel(x, y, width, height, "Keys")
+	keyboard := uint16(0)
+	if tcellIO.debug != nil {
+		keyboard = tcellIO.debug.State.Keyboard
+	}
+
+	tcellIO.keyAreas = tcellIO.keyAreas[:0]
+	for row, keys := range keypadLayout {
+		for col, key := range keys {
+			keyStyle := style
+			if keyboard&(1<<key) != 0 {
+				keyStyle = style.Reverse(true)
+			}
+			kx, ky := x+(width-11)/2+col*3, y+2+row
+			drawText(tcellIO.Screen, kx, ky, 1, fmt.Sprintf("%X", key), keyStyle)
+			tcellIO.keyAreas = append(tcellIO.keyAreas, keyArea{kx, ky, 1, 1, io.Key(1 << key)})
+		}
+	}
+}
+
+// drawDisassembly lists the instructions around the cursor, marking the PC
+// with > and breakpoints with *.
+func (tcellIO *IO) drawDisassembly(x, y, width, height int) {
+	style := tcellIO.drawPanel(x, y, width, height, "Disassembly")
+	if tcellIO.debug == nil {
+		return
+	}
+
+	info := tcellIO.debug
+	lines := height - 2
+	addr := int(tcellIO.cursor) - 2*(lines/3)
+	if addr < 0 {
+		addr = int(tcellIO.cursor) % 2
+	}
+
+	for line := 0; line < lines && addr < len(info.State.Memory); {
+		if label, ok := info.Symbols.Label(uint16(addr)); ok {
+			drawText(tcellIO.Screen, x+2, y+1+line, width-4, "      "+label+":", style)
+			line++
+			if line == lines {
+				break
+			}
+		}
+
+		d := disasm.Decode(disasm.PlatformChip8, info.State.Memory, uint16(addr))
+		marker := []rune("   ")
+		if info.Breakpoints[uint16(addr)] {
+			marker[0] = '*'
+		}
+		if uint16(addr) == info.State.PC {
+			marker[1] = '>'
+		}
+		lineStyle := style
+		if uint16(addr) == tcellIO.cursor {
+			lineStyle = style.Reverse(true)
+		}
+		text := fmt.Sprintf("%s%03X %-*s", string(marker), addr, width-10, d)
+		drawText(tcellIO.Screen, x+1, y+1+line, width-2, text, lineStyle)
+
+		line++
+		addr += int(d.Size)
+	}
+}
+
+// drawMemory shows the memory around I, which is highlighted.
+func (tcellIO *IO) drawMemory(x, y, width, height int) {
+	style := tcellIO.drawPanel(x, y, width, height, "Memory at I")
+	if tcellIO.debug == nil {
+		return
+	}
+
+	state := &tcellIO.debug.State
+	perLine := 16
+	if width-4 < 5+3*perLine {
+		perLine = 8
+	}
+	start := int(state.I)/perLine*perLine - perLine
+	if start < 0 {
+		start = 0
+	}
+
+	for line := 0; line < height-2; line++ {
+		addr := start + line*perLine
+		if addr >= len(state.Memory) {
+			break
+		}
+		drawText(tcellIO.Screen, x+2, y+1+line, width-4, fmt.Sprintf("%03X", addr), style)
+		for i := 0; i < perLine && addr+i < len(state.Memory); i++ {
+			byteStyle := style
+			if addr+i == int(state.I) {
+				byteStyle = style.Reverse(true)
+			}
+			drawText(tcellIO.Screen, x+7+3*i, y+1+line, 2, fmt.Sprintf("%02X", state.Memory[addr+i]), byteStyle)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package tcellIO
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kopi22/chip8/emulator/io"
+)
+
+const (
+	// every key of the on-screen keypad is a button of keyButtonWidth x
+	// keyButtonHeight cells, showing the key and the keyboard key below it
+	keyButtonWidth  = 5
+	keyButtonHeight = 2
+	keypadWidth     = 4*keyButtonWidth + 2
+	keypadHeight    = 4*keyButtonHeight + 2
+)
+
+// keyArea is where a key of the keypad can be clicked.
+type keyArea struct {
+	x, y, width, height int
+	key                 io.Key
+}
+
+// SetKeypad shows the keypad beside the display, where keys can be clicked
+// with the mouse. F11 shows and hides it while running.
+func (tcellIO *IO) SetKeypad(enabled bool) {
+	tcellIO.keypad = enabled
+}
+
+func (tcellIO *IO) toggleKeypad() {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	tcellIO.keypad = !tcellIO.keypad
+	tcellIO.enableMouse()
+	tcellIO.layout()
+	if tcellIO.lastFrame != nil {
+		tcellIO.drawFrame(tcellIO.lastFrame)
+	}
+	tcellIO.Screen.Show()
+}
+
+// enableMouse reports mouse events only while there are keys to click, so the
+// terminal can select text otherwise.
+func (tcellIO *IO) enableMouse() {
+	if tcellIO.keypad || tcellIO.debugging {
+		tcellIO.Screen.EnableMouse()
+	} else {
+		tcellIO.Screen.DisableMouse()
+	}
+}
+
+// keyboardRune returns the keyboard key mapped to a CHIP-8 key.
+func keyboardRune(key io.Key) rune {
+	for r, k := range io.DefaultKeyboardMap {
+		if k == key {
+			return r
+		}
+	}
+	return ' '
+}
+
+// keyAt returns the key of the keypad drawn at x, y.
+func (tcellIO *IO) keyAt(x, y int) (io.Key, bool) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	for _, area := range tcellIO.keyAreas {
+		if x >= area.x && x < area.x+area.width && y >= area.y && y < area.y+area.height {
+			return area.key, true
+		}
+	}
+	return 0, false
+}
+
+// drawKeypadButtons draws the keypad at x, y with the pressed keys
+// highlighted.
+func (tcellIO *IO) drawKeypadButtons(x, y int) {
+	style := tcellIO.drawPanel(x, y, keypadWidth, keypadHeight, "Keypad")
+	keyboard := uint16(0)
+	if tcellIO.debug != nil {
+		keyboard = tcellIO.debug.State.Keyboard
+	}
+
+	tcellIO.keyAreas = tcellIO.keyAreas[:0]
+	for row, keys := range keypadLayout {
+		for col, key := range keys {
+			bx, by := x+1+col*keyButtonWidth, y+1+row*keyButtonHeight
+			chipKey := io.Key(1 << key)
+			keyStyle := style
+			if keyboard&uint16(chipKey) != 0 {
+				keyStyle = style.Reverse(true)
+			}
+
+			drawText(tcellIO.Screen, bx, by, keyButtonWidth, fmt.Sprintf("  %X  ", key), keyStyle.Bold(true))
+			drawText(tcellIO.Screen, bx, by+1, keyButtonWidth, fmt.Sprintf(" (%c) ", keyboardRune(chipKey)), keyStyle.Dim(true))
+			tcellIO.keyAreas = append(tcellIO.keyAreas, keyArea{bx, by, keyButtonWidth, keyButtonHeight, chipKey})
+		}
+	}
+}
+
+// mouseKey turns clicks on the keypad into key presses. held is the key held
+// down with the mouse, which is released with the button.
+func (tcellIO *IO) mouseKey(ev *tcell.EventMouse, held io.Key, inputChan chan<- io.InputEvent) io.Key {
+	key := io.Key(0)
+	if ev.Buttons()&tcell.Button1 != 0 {
+		key, _ = tcellIO.keyAt(ev.Position())
+	}
+	if key == held {
+		return held
+	}
+
+	if held != 0 {
+		inputChan <- io.InputEvent{
+			EventType: io.KeyUp,
+			EventKey:  held,
+		}
+	}
+	if key != 0 {
+		inputChan <- io.InputEvent{
+			EventType: io.KeyDown,
+			EventKey:  key,
+		}
+	}
+	return key
+}
@@ -0,0 +1,53 @@
+package tcellIO
+
+import "time"
+
+// messageDuration is how long messages stay on the bottom row.
+const messageDuration = 3 * time.Second
+
+// Notify shows a message on the bottom row of the screen for a few seconds,
+// over the status bar. Messages coming while one is shown are added to it.
+func (tcellIO *IO) Notify(message string) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	if tcellIO.message != "" {
+		message = tcellIO.message + " | " + message
+	}
+	tcellIO.message = message
+	tcellIO.messageSeq++
+	seq := tcellIO.messageSeq
+	if tcellIO.messageTimer != nil {
+		tcellIO.messageTimer.Stop()
+	}
+	tcellIO.messageTimer = time.AfterFunc(messageDuration, func() {
+		tcellIO.clearMessage(seq)
+	})
+
+	if tcellIO.Screen != nil {
+		tcellIO.drawStatus()
+		tcellIO.Screen.Show()
+	}
+}
+
+// clearMessage removes the message, unless a newer one replaced it. Without
+// the status bar, the message covered part of the screen, which is drawn
+// again.
+func (tcellIO *IO) clearMessage(seq int) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	if seq != tcellIO.messageSeq || tcellIO.Screen == nil {
+		return
+	}
+	tcellIO.message = ""
+	if tcellIO.statusBar {
+		tcellIO.drawStatus()
+	} else {
+		tcellIO.layout()
+		if tcellIO.lastFrame != nil {
+			tcellIO.drawFrame(tcellIO.lastFrame)
+		}
+	}
+	tcellIO.Screen.Show()
+}
@@ -0,0 +1,174 @@
+package tcellIO
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// RenderMode is how CHIP-8 pixels are laid out on terminal cells, which are
+// about twice as tall as they are wide.
+type RenderMode string
+
+const (
+	// RenderAuto picks the mode from the terminal size.
+	RenderAuto RenderMode = "auto"
+	// RenderDouble draws each pixel as two cells side by side.
+	RenderDouble RenderMode = "double"
+	// RenderHalfBlock draws two pixels above each other in one cell with the
+	// upper half block character.
+	RenderHalfBlock RenderMode = "halfblock"
+	// RenderBraille draws 2x4 pixels in one cell with braille patterns.
+	RenderBraille RenderMode = "braille"
+	// RenderASCII is RenderHalfBlock for terminals without Unicode, using
+	// ' . : characters.
+	RenderASCII RenderMode = "ascii"
+)
+
+var renderModes = []RenderMode{RenderAuto, RenderDouble, RenderHalfBlock, RenderBraille, RenderASCII}
+
+// ParseRenderMode returns the render mode with the given name, as used by the
+// -render flag.
+func ParseRenderMode(name string) (RenderMode, error) {
+	for _, mode := range renderModes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown render mode %q", name)
+}
+
+// cells returns the number of terminal columns and rows the mode needs to
+// show a width x height display.
+func (mode RenderMode) cells(width, height int) (cols, rows int) {
+	switch mode {
+	case RenderDouble:
+		return 2 * width, height
+	case RenderBraille:
+		return (width + 1) / 2, (height + 3) / 4
+	default:
+		return width, (height + 1) / 2
+	}
+}
+
+// fit returns the largest integer scale at which the mode shows a width x
+// height display inside a border on a screen of the given size, or 0 if the
+// screen is too small.
+func (mode RenderMode) fit(width, height, screenCols, screenRows int) int {
+	scale := 0
+	for {
+		cols, rows := mode.cells(width*(scale+1), height*(scale+1))
+		if cols+2 > screenCols || rows+2 > screenRows {
+			return scale
+		}
+		scale++
+	}
+}
+
+// chooseLayout returns the mode and scale filling an area of the screen of
+// the given size. Solid blocks are preferred, as they scale up well, and the
+// denser modes are only used when the blocks do not fit. The scale is 0 if
+// nothing fits, with the mode needing the least room.
+func chooseLayout(s tcell.Screen, width, height, screenCols, screenRows int) (RenderMode, int) {
+	candidates := []RenderMode{RenderHalfBlock, RenderBraille}
+	if !s.CanDisplay('▀', false) {
+		candidates = []RenderMode{RenderDouble, RenderASCII}
+	} else if !s.CanDisplay('⣿', false) {
+		candidates = []RenderMode{RenderHalfBlock}
+	}
+
+	for _, mode := range candidates {
+		if scale := mode.fit(width, height, screenCols, screenRows); scale > 0 {
+			return mode, scale
+		}
+	}
+	return candidates[len(candidates)-1], 0
+}
+
+// brailleDots maps the pixels of a 2x4 cell to the bits of braille patterns.
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// pixelRows returns the number of pixel rows drawn on each row of cells.
+func (mode RenderMode) pixelRows() int {
+	_, rows := mode.cells(1, 4)
+	return 4 / rows
+}
+
+// cellRows returns the rows of cells showing the given rows of pixels, each of
+// them drawn as scale rows.
+func (mode RenderMode) cellRows(pixelRows []int, scale int) []int {
+	perCell := mode.pixelRows()
+	var rows []int
+	for _, row := range pixelRows {
+		for cellRow := row * scale / perCell; cellRow <= ((row+1)*scale-1)/perCell; cellRow++ {
+			if len(rows) == 0 || rows[len(rows)-1] < cellRow {
+				rows = append(rows, cellRow)
+			}
+		}
+	}
+	return rows
+}
+
+// render draws a width x height display with its top left corner at x, y.
+// level gives the brightness of a pixel from 0 to 1, and shade its colour;
+// pixels outside the display are dark. Only the given rows of cells are
+// drawn, or all of them if rows is nil.
+func (mode RenderMode) render(s tcell.Screen, x, y, width, height int, rows []int, level func(px, py int) float64, shade func(float64) tcell.Color) {
+	brightness := func(px, py int) float64 {
+		if px >= width || py >= height {
+			return 0
+		}
+		return level(px, py)
+	}
+	background := shade(0)
+	cols, totalRows := mode.cells(width, height)
+	if rows == nil {
+		for row := 0; row < totalRows; row++ {
+			rows = append(rows, row)
+		}
+	}
+
+	for _, row := range rows {
+		for col := 0; col < cols; col++ {
+			switch mode {
+			case RenderDouble:
+				c := shade(brightness(col/2, row))
+				s.SetContent(x+col, y+row, ' ', nil, tcell.StyleDefault.Foreground(c).Background(c))
+			case RenderHalfBlock:
+				top, bottom := shade(brightness(col, 2*row)), shade(brightness(col, 2*row+1))
+				s.SetContent(x+col, y+row, '▀', nil, tcell.StyleDefault.Foreground(top).Background(bottom))
+			case RenderBraille:
+				// dots are on or off, so the cell takes the colour of its
+				// brightest dot
+				pattern, brightest := rune(0x2800), 0.0
+				for dy, dots := range brailleDots {
+					for dx, dot := range dots {
+						if b := brightness(2*col+dx, 4*row+dy); b > 0 {
+							pattern |= dot
+							brightest = math.Max(brightest, b)
+						}
+					}
+				}
+				s.SetContent(x+col, y+row, pattern, nil, tcell.StyleDefault.Foreground(shade(brightest)).Background(background))
+			case RenderASCII:
+				ch := ' '
+				top, bottom := brightness(col, 2*row), brightness(col, 2*row+1)
+				switch {
+				case top > 0 && bottom > 0:
+					ch = ':'
+				case top > 0:
+					ch = '\''
+				case bottom > 0:
+					ch = '.'
+				}
+				s.SetContent(x+col, y+row, ch, nil, tcell.StyleDefault.Foreground(shade(math.Max(top, bottom))).Background(background))
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package tcellIO
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCellRows(t *testing.T) {
+	tests := []struct {
+		mode      RenderMode
+		scale     int
+		pixelRows []int
+		cellRows  []int
+	}{
+		{RenderDouble, 1, []int{0, 5, 31}, []int{0, 5, 31}},
+		{RenderDouble, 2, []int{0, 5}, []int{0, 1, 10, 11}},
+		// two pixel rows share a cell
+		{RenderHalfBlock, 1, []int{0, 1, 5, 31}, []int{0, 2, 15}},
+		{RenderHalfBlock, 2, []int{1}, []int{1}},
+		{RenderHalfBlock, 2, []int{0, 1, 2}, []int{0, 1, 2}},
+		// at an odd scale a pixel row can straddle two cells
+		{RenderHalfBlock, 3, []int{1}, []int{1, 2}},
+		{RenderHalfBlock, 3, []int{0, 1}, []int{0, 1, 2}},
+		{RenderASCII, 1, []int{3, 4}, []int{1, 2}},
+		// four pixel rows share a cell
+		{RenderBraille, 1, []int{0, 3, 4, 31}, []int{0, 1, 7}},
+		{RenderBraille, 2, []int{2}, []int{1}},
+		{RenderBraille, 3, []int{1}, []int{0, 1}},
+		{RenderBraille, 3, []int{31}, []int{23}},
+		{RenderHalfBlock, 2, nil, nil},
+	}
+
+	for _, test := range tests {
+		rows := test.mode.cellRows(test.pixelRows, test.scale)
+		if fmt.Sprint(rows) != fmt.Sprint(test.cellRows) {
+			t.Errorf("%s at scale %d: pixel rows %v are on cell rows %v, want %v",
+				test.mode, test.scale, test.pixelRows, rows, test.cellRows)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package tcellIO
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kopi22/chip8/emulator"
+)
+
+// SetStatusBar shows a line of emulator stats at the bottom of the screen.
+func (tcellIO *IO) SetStatusBar(enabled bool) {
+	tcellIO.statusBar = enabled
+}
+
+// ShowStatus redraws the status bar when the stats shown on it change.
+func (tcellIO *IO) ShowStatus(stats emulator.Stats) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	line := formatStatus(stats)
+	if !tcellIO.statusBar || line == tcellIO.statusLine {
+		return
+	}
+	tcellIO.statusLine = line
+	tcellIO.drawStatus()
+	tcellIO.Screen.Show()
+}
+
+// formatStatus lays the stats out as fields of the status bar, leaving out
+// the indicators that are off.
+func formatStatus(stats emulator.Stats) string {
+	fields := []string{
+		stats.Title,
+		fmt.Sprintf("%.0f IPS", stats.IPS),
+		fmt.Sprintf("%.0f FPS", stats.FPS),
+		fmt.Sprintf("speed %.2gx", stats.Speed),
+		"quirks " + stats.Quirks,
+	}
+	if stats.Sound {
+		fields = append(fields, "SOUND")
+	}
+	if stats.Paused {
+		fields = append(fields, "PAUSED")
+	}
+	if stats.Recording {
+		fields = append(fields, "REC")
+	}
+	return " " + strings.Join(fields, " | ")
+}
+
+// size returns the size of the screen left for the display and the panels.
+func (tcellIO *IO) size() (int, int) {
+	cols, rows := tcellIO.Screen.Size()
+	if tcellIO.statusBar {
+		rows--
+	}
+	return cols, rows
+}
+
+// drawStatus draws the status bar across the bottom row of the screen, or
+// the message while there is one.
+func (tcellIO *IO) drawStatus() {
+	line := tcellIO.statusLine
+	switch {
+	case tcellIO.message != "":
+		line = " " + tcellIO.message
+	case !tcellIO.statusBar:
+		return
+	}
+
+	screenCols, screenRows := tcellIO.Screen.Size()
+	style := tcell.StyleDefault.Reverse(true)
+	for x := 0; x < screenCols; x++ {
+		tcellIO.Screen.SetContent(x, screenRows-1, ' ', nil, style)
+	}
+	drawText(tcellIO.Screen, 0, screenRows-1, screenCols, line, style)
+}
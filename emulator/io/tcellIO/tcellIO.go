@@ -1,10 +1,13 @@
 package tcellIO
 
 import (
+	"fmt"
 	"github.com/gdamore/tcell/v2"
 	"github.com/kopi22/chip8/emulator"
 	"github.com/kopi22/chip8/emulator/io"
+	"image/color"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -18,16 +21,130 @@ func getBorderStyle() tcell.Style {
 	return tcell.StyleDefault.Foreground(tcell.ColorGray).Background(tcell.ColorBlack)
 }
 
-func getPixelOnStyle() tcell.Style {
-	return tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorWhite)
+func getPixelOnColor() tcell.Color {
+	return tcell.ColorWhite
 }
 
-func getPixelOffStyle() tcell.Style {
-	return tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorBlack)
+func getPixelOffColor() tcell.Color {
+	return tcell.ColorBlack
 }
 
 type IO struct {
-	Screen tcell.Screen
+	Screen  tcell.Screen
+	palette io.Palette
+
+	// mode is the requested render mode and rendering the one in use, which
+	// differ when the mode is chosen automatically. Every pixel is drawn as
+	// scale x scale pixels of the render mode, and the display is placed at
+	// originX, originY. A scale of 0 means the terminal is too small.
+	mode             RenderMode
+	rendering        RenderMode
+	scale            int
+	originX, originY int
+
+	// mutex guards the screen between Draw and the resize handling, which
+	// redraws the last frame.
+	mutex     sync.Mutex
+	lastFrame []byte
+
+	// phosphor, if set, fades pixels out over the frames after they go off
+	phosphor *io.Phosphor
+	done     chan struct{}
+
+	// debugging shows the debugger panels with the last state received,
+	// and a disassembly around the cursor, which follows the PC unless it
+	// was moved.
+	debugging   bool
+	debug       *emulator.DebugInfo
+	cursor      uint16
+	cursorMoved bool
+
+	// keypad shows the on-screen keypad, drawn at keypadX, keypadY when
+	// keypadShown, and keyAreas are where its keys are
+	keypad           bool
+	keypadShown      bool
+	keypadX, keypadY int
+	keyAreas         []keyArea
+
+	// statusBar shows statusLine, the last stats received, on the bottom row
+	statusBar  bool
+	statusLine string
+
+	// message is shown on the bottom row until messageTimer clears it, if
+	// messageSeq still counts it as the last
+	message      string
+	messageTimer *time.Timer
+	messageSeq   int
+}
+
+// SetPalette changes the colours, redrawing the display once it is shown.
+func (tcellIO *IO) SetPalette(palette io.Palette) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	tcellIO.palette = palette
+	if tcellIO.Screen == nil {
+		return
+	}
+	tcellIO.layout()
+	if tcellIO.lastFrame != nil {
+		tcellIO.drawFrame(tcellIO.lastFrame)
+	}
+	tcellIO.Screen.Show()
+}
+
+// SetRenderMode sets how pixels are drawn, RenderAuto by default.
+func (tcellIO *IO) SetRenderMode(mode RenderMode) {
+	tcellIO.mode = mode
+}
+
+// SetPhosphor sets a persistence filter for the display, nil by default.
+func (tcellIO *IO) SetPhosphor(phosphor *io.Phosphor) {
+	tcellIO.phosphor = phosphor
+}
+
+// shader returns the colour of pixels by brightness, blending the background
+// into the colour of lit pixels.
+func (tcellIO *IO) shader() func(level float64) tcell.Color {
+	offColor, onColor := getPixelOffColor(), getPixelOnColor()
+	off, on := color.RGBA{A: 0xFF}, color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	if len(tcellIO.palette) >= 2 {
+		off, on = tcellIO.palette[0], tcellIO.palette[1]
+		offColor, onColor = toTcellColor(off), toTcellColor(on)
+	}
+
+	return func(level float64) tcell.Color {
+		switch {
+		case level <= 0:
+			return offColor
+		case level >= 1:
+			return onColor
+		}
+		return toTcellColor(blend(off, on, level))
+	}
+}
+
+// borderStyle draws the border halfway between the background and the lit
+// pixels, on the background.
+func (tcellIO *IO) borderStyle() tcell.Style {
+	if len(tcellIO.palette) < 2 {
+		return getBorderStyle()
+	}
+
+	off, on := tcellIO.palette[0], tcellIO.palette[1]
+	return tcell.StyleDefault.Foreground(toTcellColor(blend(off, on, 0.5))).Background(toTcellColor(off))
+}
+
+// blend mixes the colours, from all of a at 0 to all of b at 1.
+func blend(a, b color.RGBA, amount float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*amount + 0.5)
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 0xFF}
+}
+
+func toTcellColor(c color.RGBA) tcell.Color {
+	return tcell.NewRGBColor(int32(c.R), int32(c.G), int32(c.B))
 }
 
 func (tcellIO *IO) Init() {
@@ -43,38 +160,190 @@ func (tcellIO *IO) Init() {
 	tcellIO.Screen = s
 
 	tcellIO.Screen.SetStyle(getDefaultDisplayStyle())
+	tcellIO.enableMouse()
+	tcellIO.layout()
+
+	tcellIO.done = make(chan struct{})
+	if tcellIO.phosphor != nil {
+		go tcellIO.fade(tcellIO.done)
+	}
+}
+
+// fade advances the phosphor every frame, so pixels keep fading while the
+// program draws nothing.
+func (tcellIO *IO) fade(done <-chan struct{}) {
+	ticker := time.NewTicker(emulator.TimerPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			tcellIO.mutex.Lock()
+			if tcellIO.lastFrame != nil && tcellIO.phosphor.Advance(tcellIO.lastFrame) {
+				tcellIO.drawFrame(tcellIO.lastFrame)
+				tcellIO.Screen.Show()
+			}
+			tcellIO.mutex.Unlock()
+		}
+	}
+}
+
+// layout chooses the render mode and the scale filling the screen and draws
+// the border of the display centred on it, or a message if it does not fit.
+// With the debugger shown, the display fills the top left of the screen and
+// the panels are drawn around it. The status bar keeps the bottom row.
+func (tcellIO *IO) layout() {
+	screenCols, screenRows := tcellIO.size()
+	haveCols, haveRows := tcellIO.Screen.Size()
+	areaCols, areaRows := screenCols, screenRows
+	if tcellIO.debugging {
+		areaCols, areaRows = screenCols-debugPanelWidth, screenRows-memoryPanelMinHeight
+		if haveCols < debugMinCols || haveRows < debugMinRows {
+			areaCols, areaRows = 0, 0
+		}
+	}
+
+	// the keypad goes right of the display if both fit
+	tcellIO.keypadShown = tcellIO.keypad && !tcellIO.debugging && screenRows >= keypadHeight
+	if tcellIO.keypadShown {
+		tcellIO.fitDisplay(areaCols-keypadWidth-1, areaRows)
+		tcellIO.keypadShown = tcellIO.scale > 0
+	}
+	if !tcellIO.keypadShown {
+		tcellIO.fitDisplay(areaCols, areaRows)
+	}
+
 	tcellIO.Screen.Clear()
+	tcellIO.keyAreas = tcellIO.keyAreas[:0]
+	tcellIO.drawStatus()
+
+	if tcellIO.scale == 0 {
+		cols, rows := tcellIO.rendering.cells(emulator.DisplayWidth, emulator.DisplayHeight)
+		needCols, needRows := cols+2, rows+2+haveRows-screenRows
+		title := "Terminal too small"
+		if tcellIO.debugging {
+			title = "Terminal too small for the debugger"
+			needCols, needRows = debugMinCols, debugMinRows
+		}
+		drawCentered(tcellIO.Screen, getDefaultDisplayStyle(),
+			title,
+			fmt.Sprintf("need %dx%d, have %dx%d", needCols, needRows, haveCols, haveRows))
+		return
+	}
 
 	// Draw Chip Display
-	drawBox(tcellIO.Screen, 0, 0, 65, 33, getBorderStyle())
+	cols, rows := tcellIO.rendering.cells(emulator.DisplayWidth*tcellIO.scale, emulator.DisplayHeight*tcellIO.scale)
+	tcellIO.originX, tcellIO.originY = (areaCols-cols-2)/2, (areaRows-rows-2)/2
+	if tcellIO.keypadShown {
+		tcellIO.originX = (areaCols - cols - 3 - keypadWidth) / 2
+		tcellIO.keypadX = tcellIO.originX + cols + 3
+		tcellIO.keypadY = tcellIO.originY + (rows+2-keypadHeight)/2
+		if tcellIO.keypadY < 0 {
+			tcellIO.keypadY = 0
+		}
+	}
+	if tcellIO.debugging {
+		tcellIO.originY = 0
+	}
+	drawBox(tcellIO.Screen, tcellIO.originX, tcellIO.originY, tcellIO.originX+cols+1, tcellIO.originY+rows+1, tcellIO.borderStyle())
+	if tcellIO.debugging {
+		tcellIO.drawDebug()
+	}
+	if tcellIO.keypadShown {
+		tcellIO.drawKeypadButtons(tcellIO.keypadX, tcellIO.keypadY)
+	}
+}
+
+// fitDisplay chooses the render mode and the scale filling an area of the
+// screen.
+func (tcellIO *IO) fitDisplay(areaCols, areaRows int) {
+	if tcellIO.mode == "" || tcellIO.mode == RenderAuto {
+		tcellIO.rendering, tcellIO.scale = chooseLayout(tcellIO.Screen, emulator.DisplayWidth, emulator.DisplayHeight, areaCols, areaRows)
+	} else {
+		tcellIO.rendering = tcellIO.mode
+		tcellIO.scale = tcellIO.mode.fit(emulator.DisplayWidth, emulator.DisplayHeight, areaCols, areaRows)
+	}
+}
+
+// resize lays the screen out again and redraws the last frame on it.
+func (tcellIO *IO) resize() {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
+
+	tcellIO.layout()
+	if tcellIO.lastFrame != nil {
+		tcellIO.drawFrame(tcellIO.lastFrame)
+	}
+	tcellIO.Screen.Sync()
 }
 
 func (tcellIO *IO) Fini() {
+	tcellIO.mutex.Lock()
+	if tcellIO.messageTimer != nil {
+		tcellIO.messageTimer.Stop()
+	}
+	tcellIO.mutex.Unlock()
+
+	close(tcellIO.done)
 	tcellIO.Screen.Fini()
 }
 
 func (tcellIO *IO) Draw(frameBuffer []byte) {
-	pixelOffStyle := getPixelOffStyle()
-	pixelOnStyle := getPixelOnStyle()
-
-	for r := 0; r < emulator.DisplayHeight; r++ {
-		for c := 0; c < emulator.DisplayWidth; c++ {
-			totalOffset := r*emulator.DisplayWidth + c
-			byteOffset, bitOffset := totalOffset/8, totalOffset%8
-			pixelMask := byte(0x80 >> bitOffset)
-
-			if frameBuffer[byteOffset]&pixelMask == 0 {
-				tcellIO.Screen.SetContent(c+1, r+1, ' ', nil, pixelOffStyle)
-			} else {
-				tcellIO.Screen.SetContent(c+1, r+1, ' ', nil, pixelOnStyle)
-			}
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
 
-		}
+	tcellIO.lastFrame = append(tcellIO.lastFrame[:0], frameBuffer...)
+	if tcellIO.phosphor != nil {
+		tcellIO.phosphor.Light(frameBuffer)
 	}
+	tcellIO.drawFrame(frameBuffer)
+	tcellIO.Screen.Show()
+}
+
+// DrawRows redraws only the cells showing the given rows of the display.
+func (tcellIO *IO) DrawRows(frameBuffer []byte, rows []int) {
+	tcellIO.mutex.Lock()
+	defer tcellIO.mutex.Unlock()
 
+	tcellIO.lastFrame = append(tcellIO.lastFrame[:0], frameBuffer...)
+	if tcellIO.phosphor != nil {
+		tcellIO.phosphor.Light(frameBuffer)
+	}
+	tcellIO.drawRows(frameBuffer, tcellIO.rendering.cellRows(rows, tcellIO.scale))
 	tcellIO.Screen.Show()
 }
 
+func (tcellIO *IO) drawFrame(frameBuffer []byte) {
+	tcellIO.drawRows(frameBuffer, nil)
+}
+
+// drawRows draws the given rows of cells, or all of them if rows is nil.
+func (tcellIO *IO) drawRows(frameBuffer []byte, rows []int) {
+	scale := tcellIO.scale
+	if scale == 0 {
+		return
+	}
+
+	level := func(c, r int) float64 {
+		totalOffset := r/scale*emulator.DisplayWidth + c/scale
+		if tcellIO.phosphor != nil {
+			return tcellIO.phosphor.Level(totalOffset)
+		}
+
+		byteOffset, bitOffset := totalOffset/8, totalOffset%8
+		pixelMask := byte(0x80 >> bitOffset)
+		if frameBuffer[byteOffset]&pixelMask == 0 {
+			return 0
+		}
+		return 1
+	}
+
+	tcellIO.rendering.render(tcellIO.Screen, tcellIO.originX+1, tcellIO.originY+1,
+		emulator.DisplayWidth*scale, emulator.DisplayHeight*scale, rows, level, tcellIO.shader())
+}
+
 func (tcellIO *IO) Clear() {
 	tcellIO.Screen.Clear()
 }
@@ -88,6 +357,8 @@ func (tcellIO *IO) FetchInputEvents(inputChan chan<- io.InputEvent) {
 	pressTimer := keyPressTimer{
 		time.NewTimer(0), io.Key(0),
 	}
+	// the key held down with the mouse on the keypad
+	mouseKey := io.Key(0)
 
 	eventChan := make(chan tcell.Event)
 	go func() {
@@ -106,13 +377,46 @@ func (tcellIO *IO) FetchInputEvents(inputChan chan<- io.InputEvent) {
 			// Process event
 			switch ev := ev.(type) {
 			case *tcell.EventResize:
-				tcellIO.Screen.Sync()
+				tcellIO.resize()
+			case *tcell.EventMouse:
+				mouseKey = tcellIO.mouseKey(ev, mouseKey, inputChan)
 			case *tcell.EventKey:
+				if tcellIO.debugging {
+					if event, ok := tcellIO.debugKey(ev); ok {
+						inputChan <- event
+						break
+					}
+				}
+
 				switch ev.Key() {
+				case tcell.KeyF11:
+					tcellIO.toggleKeypad()
+				case tcell.KeyF12:
+					tcellIO.toggleDebugger()
 				case tcell.KeyCtrlC:
 					inputChan <- io.InputEvent{
 						EventType: io.Quit,
 					}
+				case tcell.KeyF2:
+					inputChan <- io.InputEvent{
+						EventType: io.NextPalette,
+					}
+				case tcell.KeyF3:
+					inputChan <- io.InputEvent{
+						EventType: io.Screenshot,
+					}
+				case tcell.KeyF4:
+					inputChan <- io.InputEvent{
+						EventType: io.ToggleRecording,
+					}
+				case tcell.KeyF5:
+					inputChan <- io.InputEvent{
+						EventType: io.SaveState,
+					}
+				case tcell.KeyF9:
+					inputChan <- io.InputEvent{
+						EventType: io.LoadState,
+					}
 				case tcell.KeyRune:
 					key, ok := io.DefaultKeyboardMap[ev.Rune()]
 					if ok {
@@ -179,6 +483,21 @@ func drawBox(s tcell.Screen, x1, y1, x2, y2 int, style tcell.Style) {
 	}
 }
 
+// drawCentered writes lines of text in the middle of the screen.
+func drawCentered(s tcell.Screen, style tcell.Style, lines ...string) {
+	screenCols, screenRows := s.Size()
+	y := (screenRows - len(lines)) / 2
+	for i, line := range lines {
+		x := (screenCols - len(line)) / 2
+		if x < 0 {
+			x = 0
+		}
+		for j, ch := range line {
+			s.SetContent(x+j, y+i, ch, nil, style)
+		}
+	}
+}
+
 //func (tcellIO IO) drawPixel(col, row int) {
 //	// TODO: IMPLEMENT
 //}
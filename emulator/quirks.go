@@ -0,0 +1,20 @@
+package emulator
+
+// Quirks selects between the behaviours of the different CHIP-8
+// interpreters for the instructions they disagree on.
+type Quirks struct {
+	Shift     bool // 8xy6/8xyE shift Vx in place and ignore Vy
+	LoadStore bool // Fx55/Fx65 leave I unchanged
+	IncrByX   bool // Fx55/Fx65 increment I by x instead of x + 1
+	Jump      bool // Bnnn jumps to Vx + nnn instead of V0 + nnn
+	VFReset   bool // 8xy1/8xy2/8xy3 reset VF to 0
+	Clip      bool // sprites are clipped at the screen edges instead of wrapping
+	VBlank    bool // DRW waits for the next timer tick before the program continues
+}
+
+func DefaultQuirks() Quirks {
+	return Quirks{
+		Shift:     true,
+		LoadStore: true,
+	}
+}
@@ -0,0 +1,275 @@
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path"
+	"time"
+)
+
+// GIFExtension and Y4MExtension choose the format of recordings: an animated
+// GIF, or uncompressed YUV4MPEG2 video for other tools to transcode.
+const (
+	GIFExtension = ".gif"
+	Y4MExtension = ".y4m"
+)
+
+// minGIFDelay is the shortest delay between GIF frames, in hundredths of a
+// second. Browsers slow shorter delays down, so frames coming sooner replace
+// the one before them.
+const minGIFDelay = 2
+
+// frameWriter writes the frames of a recording to its file.
+type frameWriter interface {
+	writeFrame(img *image.Paletted) error
+	close() error
+}
+
+// SetRecordingFormat sets the extension of the files recorded with the
+// ToggleRecording event, GIFExtension by default.
+func (emu *Emulator) SetRecordingFormat(extension string) *Emulator {
+	emu.recordingExtension = extension
+	return emu
+}
+
+// StartRecording records the display to a file, starting with the current
+// one and adding one every frame until StopRecording or the emulator quits.
+// The extension of the file chooses the format, GIFExtension or
+// Y4MExtension.
+func (emu *Emulator) StartRecording(filename string) error {
+	if err := emu.StopRecording(); err != nil {
+		return err
+	}
+
+	extension := path.Ext(filename)
+	if extension != GIFExtension && extension != Y4MExtension {
+		return fmt.Errorf("%s: unknown recording format, use %s or %s", filename, GIFExtension, Y4MExtension)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if extension == GIFExtension {
+		emu.recording = newGIFWriter(file)
+	} else {
+		emu.recording = newY4MWriter(file)
+	}
+
+	// so that even a recording stopped straight away is a valid file
+	if err := emu.recording.writeFrame(emu.frameImage()); err != nil {
+		emu.StopRecording()
+		return err
+	}
+	return nil
+}
+
+// StopRecording finishes the recording, if there is one.
+func (emu *Emulator) StopRecording() error {
+	if emu.recording == nil {
+		return nil
+	}
+	err := emu.recording.close()
+	emu.recording = nil
+	return err
+}
+
+// Recording reports whether the display is being recorded.
+func (emu *Emulator) Recording() bool {
+	return emu.recording != nil
+}
+
+// toggleRecording starts or stops recording for the ToggleRecording event.
+func (emu *Emulator) toggleRecording() {
+	if emu.Recording() {
+		if err := emu.StopRecording(); err != nil {
+			emu.notify("recording: %v", err)
+		} else {
+			emu.notify("saved recording")
+		}
+		return
+	}
+
+	extension := emu.recordingExtension
+	if extension == "" {
+		extension = GIFExtension
+	}
+	filename := emu.capturePath(extension)
+	if err := emu.StartRecording(filename); err != nil {
+		emu.notify("recording: %v", err)
+		return
+	}
+	emu.notify("recording to %s", filename)
+}
+
+// recordFrame adds the display to the recording, stopping it on errors.
+func (emu *Emulator) recordFrame() {
+	if emu.recording == nil {
+		return
+	}
+	if err := emu.recording.writeFrame(emu.frameImage()); err != nil {
+		emu.notify("recording: %v", err)
+		emu.StopRecording()
+	}
+}
+
+// gifWriter streams an animated GIF. image/gif only encodes whole
+// animations, so every frame is encoded as an animation of its own, whose
+// image block is copied to the file. A frame is held back until the next
+// different one, which gives its duration; identical frames in a row are
+// merged into one.
+type gifWriter struct {
+	file *os.File
+	w    *bufio.Writer
+	// config is the size and the global palette, from the first frame
+	config  image.Config
+	pending *image.Paletted
+	start   int // the frame number pending starts at
+	frames  int
+}
+
+// gifLoop is the NETSCAPE2.0 extension, playing the animation forever.
+var gifLoop = []byte{0x21, 0xFF, 0x0B, 'N', 'E', 'T', 'S', 'C', 'A', 'P', 'E', '2', '.', '0', 0x03, 0x01, 0x00, 0x00, 0x00}
+
+const gifTrailer = 0x3B
+
+func newGIFWriter(file *os.File) *gifWriter {
+	return &gifWriter{file: file, w: bufio.NewWriter(file)}
+}
+
+// hundredths returns the time of a frame in hundredths of a second.
+func hundredths(frame int) int {
+	return int(time.Duration(frame) * TimerPeriod / (10 * time.Millisecond))
+}
+
+func (w *gifWriter) writeFrame(img *image.Paletted) error {
+	frame := w.frames
+	w.frames++
+
+	if w.pending != nil {
+		switch delay := hundredths(frame) - hundredths(w.start); {
+		case samePaletted(w.pending, img):
+			return nil
+		case delay < minGIFDelay:
+			w.pending = img
+			return nil
+		default:
+			if err := w.flush(delay); err != nil {
+				return err
+			}
+		}
+	}
+	w.pending, w.start = img, frame
+	return nil
+}
+
+// flush writes the pending frame, shown for delay hundredths of a second.
+// The header of the first one starts the file.
+func (w *gifWriter) flush(delay int) error {
+	first := w.config.ColorModel == nil
+	if first {
+		size := w.pending.Bounds().Size()
+		w.config = image.Config{ColorModel: w.pending.Palette, Width: size.X, Height: size.Y}
+	}
+
+	// frames whose palette differs from the global one get their own
+	var buf bytes.Buffer
+	anim := &gif.GIF{Image: []*image.Paletted{w.pending}, Delay: []int{delay}, Config: w.config}
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return err
+	}
+
+	// the header and screen descriptor are followed by the global palette
+	data := buf.Bytes()
+	header := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		header += 3 << (flags&7 + 1)
+	}
+	if first {
+		w.w.Write(data[:header])
+		w.w.Write(gifLoop)
+	}
+	w.w.Write(data[header : len(data)-1])
+	return w.w.Flush()
+}
+
+func (w *gifWriter) close() error {
+	defer w.file.Close()
+
+	if w.pending != nil {
+		delay := hundredths(w.frames) - hundredths(w.start)
+		if delay < minGIFDelay {
+			delay = minGIFDelay
+		}
+		if err := w.flush(delay); err != nil {
+			return err
+		}
+		w.w.WriteByte(gifTrailer)
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func samePaletted(a, b *image.Paletted) bool {
+	if !bytes.Equal(a.Pix, b.Pix) || len(a.Palette) != len(b.Palette) {
+		return false
+	}
+	for i := range a.Palette {
+		if a.Palette[i] != b.Palette[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// y4mWriter streams the frames as full range 4:4:4 YUV4MPEG2.
+type y4mWriter struct {
+	file   *os.File
+	w      *bufio.Writer
+	header bool
+}
+
+func newY4MWriter(file *os.File) *y4mWriter {
+	return &y4mWriter{file: file, w: bufio.NewWriter(file)}
+}
+
+func (w *y4mWriter) writeFrame(img *image.Paletted) error {
+	size := img.Bounds().Size()
+	if !w.header {
+		fmt.Fprintf(w.w, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C444 XCOLORRANGE=FULL\n",
+			size.X, size.Y, time.Second/time.Millisecond, TimerPeriod/time.Millisecond)
+		w.header = true
+	}
+
+	// the planes of the palette colours
+	planes := make([][3]byte, len(img.Palette))
+	for i, c := range img.Palette {
+		r, g, b, _ := c.RGBA()
+		y, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+		planes[i] = [3]byte{y, cb, cr}
+	}
+
+	w.w.WriteString("FRAME\n")
+	for plane := 0; plane < 3; plane++ {
+		for _, index := range img.Pix {
+			w.w.WriteByte(planes[index][plane])
+		}
+	}
+	return w.w.Flush()
+}
+
+func (w *y4mWriter) close() error {
+	defer w.file.Close()
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
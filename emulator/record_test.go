@@ -0,0 +1,129 @@
+package emulator
+
+import (
+	"bytes"
+	"fmt"
+	"image/gif"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// record starts recording to a file of the given name in a temporary
+// directory, then shows the frame buffers from displays in turn, one per
+// frame, and returns the contents of the file.
+func record(t *testing.T, name string, displays ...[]byte) []byte {
+	dir, err := ioutil.TempDir("", "chip8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, name)
+
+	emu := NewEmulator().SetScreenshotScale(1)
+	if err := emu.StartRecording(filename); err != nil {
+		t.Fatal(err)
+	}
+	for _, display := range displays {
+		copy(emu.chipState.FrameBuf, display)
+		emu.recordFrame()
+	}
+	if err := emu.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func display(lit ...int) []byte {
+	fb := make([]byte, DisplayWidth*DisplayHeight/8)
+	for _, offset := range lit {
+		fb[offset/8] |= 0x80 >> (offset % 8)
+	}
+	return fb
+}
+
+func TestGIFRecording(t *testing.T) {
+	a, b, c := display(), display(0), display(1)
+	tests := []struct {
+		name     string
+		displays [][]byte
+		delays   []int
+	}{
+		{"stopped at once", nil, []int{minGIFDelay}},
+		{"same display", [][]byte{a, a, a}, []int{6}},
+		// frames at 0, 17, 34, ... ms, rounded down to hundredths
+		{"changes", [][]byte{a, a, b, b, b, a, a}, []int{5, 5, 3}},
+		// c is shown for less than minGIFDelay and is replaced by the next
+		{"short frame", [][]byte{a, a, b, b, b, c, a, a, a}, []int{5, 5, 7}},
+	}
+
+	for _, test := range tests {
+		data := record(t, "test.gif", test.displays...)
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if fmt.Sprint(anim.Delay) != fmt.Sprint(test.delays) {
+			t.Errorf("%s: delays %v, want %v", test.name, anim.Delay, test.delays)
+		}
+		if anim.LoopCount != 0 {
+			t.Errorf("%s: loop count %d, want 0 (forever)", test.name, anim.LoopCount)
+		}
+		if size := anim.Image[0].Bounds().Size(); size.X != DisplayWidth || size.Y != DisplayHeight {
+			t.Errorf("%s: frames are %v, want %dx%d", test.name, size, DisplayWidth, DisplayHeight)
+		}
+	}
+}
+
+func TestGIFRecordingFrames(t *testing.T) {
+	data := record(t, "test.gif", display(), display(0), display(0), display(5), display(5))
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lit := []int{-1, 0, 5}
+	if len(anim.Image) != len(lit) {
+		t.Fatalf("%d frames, want %d", len(anim.Image), len(lit))
+	}
+	for i, img := range anim.Image {
+		for offset, index := range img.Pix {
+			if want := offset == lit[i]; (index != 0) != want {
+				t.Errorf("frame %d: pixel %d lit is %v, want %v", i, offset, index != 0, want)
+			}
+		}
+	}
+}
+
+func TestY4MRecording(t *testing.T) {
+	data := record(t, "test.y4m", display(), display(0))
+
+	header := fmt.Sprintf("YUV4MPEG2 W%d H%d F1000:17 Ip A1:1 C444 XCOLORRANGE=FULL\n", DisplayWidth, DisplayHeight)
+	if !bytes.HasPrefix(data, []byte(header)) {
+		t.Fatalf("header %q, want %q", data[:bytes.IndexByte(data, '\n')+1], header)
+	}
+
+	frameSize := len("FRAME\n") + 3*DisplayWidth*DisplayHeight
+	frames := data[len(header):]
+	if len(frames) != 3*frameSize {
+		t.Fatalf("%d bytes of frames, want 3 frames of %d", len(frames), frameSize)
+	}
+	for i := 0; i < 3; i++ {
+		frame := frames[i*frameSize : (i+1)*frameSize]
+		if !bytes.HasPrefix(frame, []byte("FRAME\n")) {
+			t.Errorf("frame %d does not start with FRAME", i)
+		}
+		// the luma of the first pixel is only bright in the last frame
+		y := frame[len("FRAME\n")]
+		background := frames[len("FRAME\n")+1]
+		if lit := y != background; lit != (i == 2) {
+			t.Errorf("frame %d: first pixel lit is %v", i, lit)
+		}
+	}
+}
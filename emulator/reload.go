@@ -0,0 +1,68 @@
+package emulator
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ReloadPollPeriod is how often a ROM is checked for changes with hot reload.
+const ReloadPollPeriod = 500 * time.Millisecond
+
+// StateExtension replaces the extension of a ROM to name its save state.
+const StateExtension = ".state"
+
+// SetHotReload makes Launch watch the ROM file. Whenever it changes the
+// program is read again, Octo source recompiled, and the new bytes replace
+// the program in memory while the machine keeps running.
+func (emu *Emulator) SetHotReload(enabled bool) *Emulator {
+	emu.hotReload = enabled
+	return emu
+}
+
+// SetStateFile sets the save state file used by the save and load state keys.
+// When set, it is also restored after every hot reload, so a change can be
+// tested from the same point of the game each time.
+func (emu *Emulator) SetStateFile(filename string) *Emulator {
+	emu.stateFile = filename
+	return emu
+}
+
+// statePath returns the save state file, by default the ROM name with the
+// .state extension.
+func (emu *Emulator) statePath() string {
+	if emu.stateFile != "" {
+		return emu.stateFile
+	}
+	return strings.TrimSuffix(emu.romPath, path.Ext(emu.romPath)) + StateExtension
+}
+
+func (emu *Emulator) romChanged() bool {
+	info, err := os.Stat(emu.romPath)
+	if err != nil || info.ModTime().Equal(emu.romModTime) {
+		return false
+	}
+	emu.romModTime = info.ModTime()
+	return true
+}
+
+// reload replaces the program with the current contents of the ROM file.
+// Errors, like a half written file or source that does not compile, are
+// shown and the old program keeps running.
+func (emu *Emulator) reload() {
+	program, err := emu.readProgram(emu.romPath)
+	if err != nil {
+		emu.notify("reload: %v", err)
+		return
+	}
+
+	if emu.stateFile != "" {
+		if err := emu.LoadState(emu.stateFile); err != nil && !os.IsNotExist(err) {
+			emu.notify("reload: %v", err)
+		}
+	}
+	emu.loadProgram(program)
+	emu.waitingForVBlank = false
+	emu.chipState.markAllRows()
+}
@@ -0,0 +1,225 @@
+package romdb
+
+import (
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// LocalDir is checked for a database that overrides the embedded one. The
+// embedded files are kept as chip-8-database has them; local corrections go
+// in LocalDir.
+const LocalDir = "roms/database"
+
+const (
+	programsFile  = "programs.json"
+	hashesFile    = "sha1-hashes.json"
+	platformsFile = "platforms.json"
+)
+
+//go:embed database
+var embedded embed.FS
+
+// Program, Rom and Platform follow the chip-8-database JSON format.
+type Program struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Release     string         `json:"release"`
+	Authors     []string       `json:"authors"`
+	Roms        map[string]Rom `json:"roms"`
+}
+
+type Rom struct {
+	File            string                     `json:"file"`
+	EmbeddedTitle   string                     `json:"embeddedTitle"`
+	Platforms       []string                   `json:"platforms"`
+	QuirkyPlatforms map[string]map[string]bool `json:"quirkyPlatforms"`
+	Tickrate        int                        `json:"tickrate"`
+	StartAddress    int                        `json:"startAddress"`
+	ScreenRotation  int                        `json:"screenRotation"`
+	Keys            map[string]int             `json:"keys"`
+	Colors          *Colors                    `json:"colors"`
+}
+
+type Colors struct {
+	Pixels  []string `json:"pixels"`
+	Buzzer  string   `json:"buzzer"`
+	Silence string   `json:"silence"`
+}
+
+type Platform struct {
+	ID              string          `json:"id"`
+	Name            string          `json:"name"`
+	DefaultTickrate int             `json:"defaultTickrate"`
+	Quirks          map[string]bool `json:"quirks"`
+}
+
+type Database struct {
+	programs  []Program
+	hashes    map[string]int
+	platforms map[string]Platform
+}
+
+// Entry is the result of a lookup, with the platform defaults already merged
+// into the ROM specific settings.
+type Entry struct {
+	Program  *Program
+	Rom      *Rom
+	Platform *Platform
+	Quirks   map[string]bool
+	Tickrate int
+}
+
+// Load reads a database from the directory layout of chip-8-database.
+func Load(fsys fs.FS) (*Database, error) {
+	db := &Database{}
+
+	if err := readJSON(fsys, programsFile, &db.programs); err != nil {
+		return nil, err
+	}
+	if err := readJSON(fsys, hashesFile, &db.hashes); err != nil {
+		return nil, err
+	}
+
+	var platforms []Platform
+	if err := readJSON(fsys, platformsFile, &platforms); err != nil {
+		return nil, err
+	}
+	db.platforms = make(map[string]Platform)
+	for _, platform := range platforms {
+		db.platforms[platform.ID] = platform
+	}
+
+	return db, nil
+}
+
+// Default returns the embedded database, overridden by LocalDir if it exists.
+// The override may leave out any of the files to keep the embedded ones,
+// though programs and their hashes only come together. If the override cannot
+// be read, the embedded database is returned along with the error.
+func Default() (*Database, error) {
+	sub, err := fs.Sub(embedded, "database")
+	if err != nil {
+		return nil, err
+	}
+	db, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(LocalDir); err == nil && info.IsDir() {
+		local, err := loadPartial(os.DirFS(LocalDir))
+		if err != nil {
+			return db, fmt.Errorf("%s: %v", LocalDir, err)
+		}
+		db.merge(local)
+	}
+
+	return db, nil
+}
+
+// loadPartial is Load for a database missing some of its files.
+func loadPartial(fsys fs.FS) (*Database, error) {
+	db := &Database{
+		hashes:    make(map[string]int),
+		platforms: make(map[string]Platform),
+	}
+
+	hasPrograms, hasHashes := exists(fsys, programsFile), exists(fsys, hashesFile)
+	if hasPrograms != hasHashes {
+		return nil, fmt.Errorf("%s and %s go together", programsFile, hashesFile)
+	}
+	if hasPrograms {
+		if err := readJSON(fsys, programsFile, &db.programs); err != nil {
+			return nil, err
+		}
+		if err := readJSON(fsys, hashesFile, &db.hashes); err != nil {
+			return nil, err
+		}
+	}
+
+	if exists(fsys, platformsFile) {
+		var platforms []Platform
+		if err := readJSON(fsys, platformsFile, &platforms); err != nil {
+			return nil, err
+		}
+		for _, platform := range platforms {
+			db.platforms[platform.ID] = platform
+		}
+	}
+
+	return db, nil
+}
+
+func exists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return err == nil
+}
+
+// merge adds the programs and platforms of other, replacing any entries that
+// both databases describe.
+func (db *Database) merge(other *Database) {
+	offset := len(db.programs)
+	db.programs = append(db.programs, other.programs...)
+	for hash, index := range other.hashes {
+		db.hashes[hash] = offset + index
+	}
+	for id, platform := range other.platforms {
+		db.platforms[id] = platform
+	}
+}
+
+func (db *Database) Lookup(data []byte) (*Entry, bool) {
+	sum := sha1.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+
+	index, ok := db.hashes[hash]
+	if !ok || index < 0 || index >= len(db.programs) {
+		return nil, false
+	}
+	program := &db.programs[index]
+	rom, ok := program.Roms[hash]
+	if !ok {
+		return nil, false
+	}
+
+	entry := &Entry{
+		Program:  program,
+		Rom:      &rom,
+		Quirks:   make(map[string]bool),
+		Tickrate: rom.Tickrate,
+	}
+
+	// the first listed platform is the one the ROM was written for
+	if len(rom.Platforms) > 0 {
+		if platform, ok := db.platforms[rom.Platforms[0]]; ok {
+			entry.Platform = &platform
+			for name, value := range platform.Quirks {
+				entry.Quirks[name] = value
+			}
+			if entry.Tickrate == 0 {
+				entry.Tickrate = platform.DefaultTickrate
+			}
+		}
+		for name, value := range rom.QuirkyPlatforms[rom.Platforms[0]] {
+			entry.Quirks[name] = value
+		}
+	}
+
+	return entry, true
+}
+
+func readJSON(fsys fs.FS, name string, v interface{}) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package emulator
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+)
+
+// SaveState writes a snapshot of the machine to a file.
+func (emu *Emulator) SaveState(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := gob.NewEncoder(file).Encode(emu.chipState); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// LoadState restores a snapshot written by SaveState.
+func (emu *Emulator) LoadState(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	state := new(State)
+	if err := gob.NewDecoder(file).Decode(state); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(state.Memory) != len(emu.chipState.Memory) {
+		return fmt.Errorf("%s: not a save state of this machine", filename)
+	}
+
+	// FrameBuf is a slice of Memory, which gob decodes as a separate copy
+	state.FrameBuf = frameBuffer(state.Memory)
+	state.Keyboard = 0
+	state.markAllRows()
+	emu.chipState = state
+	emu.waitingForVBlank = false
+	return nil
+}
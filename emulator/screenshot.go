@@ -0,0 +1,87 @@
+package emulator
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/kopi22/chip8/emulator/io"
+)
+
+// ScreenshotExtension is the extension of the PNG files written by the
+// Screenshot event.
+const ScreenshotExtension = ".png"
+
+// DefaultScreenshotScale is the size in image pixels of every display pixel
+// in screenshots and recordings.
+const DefaultScreenshotScale = 8
+
+// SetScreenshotScale sets the size in image pixels of every display pixel in
+// screenshots and recordings.
+func (emu *Emulator) SetScreenshotScale(scale int) *Emulator {
+	if scale > 0 {
+		emu.screenshotScale = scale
+	}
+	return emu
+}
+
+// SetScreenshotPalette sets the colours of screenshots and recordings. By
+// default they use the palette of the display.
+func (emu *Emulator) SetScreenshotPalette(palette io.Palette) *Emulator {
+	emu.screenshotPalette = palette
+	return emu
+}
+
+// Screenshot draws the display as an image, in the scale and palette of
+// screenshots.
+func (emu *Emulator) Screenshot() image.Image {
+	return emu.frameImage()
+}
+
+// frameImage draws the display for screenshots and recordings.
+func (emu *Emulator) frameImage() *image.Paletted {
+	palette := emu.screenshotPalette
+	if palette == nil {
+		palette = emu.palette
+	}
+	return io.FrameImage(emu.chipState.FrameBuf, DisplayWidth, DisplayHeight, emu.screenshotScale, palette)
+}
+
+// SaveScreenshot writes the display to a PNG file.
+func (emu *Emulator) SaveScreenshot(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, emu.Screenshot()); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// capturePath returns the first unused file name for a screenshot or a
+// recording, the ROM name numbered from 1 with the given extension.
+func (emu *Emulator) capturePath(extension string) string {
+	base := strings.TrimSuffix(emu.romPath, path.Ext(emu.romPath))
+	for i := 1; ; i++ {
+		filename := fmt.Sprintf("%s-%d%s", base, i, extension)
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return filename
+		}
+	}
+}
+
+// takeScreenshot saves the display for the Screenshot event.
+func (emu *Emulator) takeScreenshot() {
+	filename := emu.capturePath(ScreenshotExtension)
+	if err := emu.SaveScreenshot(filename); err != nil {
+		emu.notify("screenshot: %v", err)
+		return
+	}
+	emu.notify("saved screenshot to %s", filename)
+}
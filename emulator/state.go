@@ -2,6 +2,7 @@ package emulator
 
 const FONTSET_LOCATION = 0x0
 const INITIAL_PC = 0x200
+const FRAMEBUF_LOCATION = 0xF00
 
 type State struct {
 	V        [16]byte
@@ -14,20 +15,62 @@ type State struct {
 	FrameBuf []byte
 	Stack    [16]uint16
 	Keyboard uint16
+	Quirks   Quirks
+
+	// dirtyRows has bit n set when row n of the display changed since it was
+	// last presented.
+	dirtyRows uint64
 }
 
 func InitChipState() *State {
 	state := &State{
 		PC:     INITIAL_PC,
 		Memory: make([]byte, 4096), // 4kb
+		Quirks: DefaultQuirks(),
 	}
-	state.FrameBuf = state.Memory[0xf00:(0xf00 + 64*32/8)]
+	state.FrameBuf = frameBuffer(state.Memory)
 
 	copy(state.Memory[FONTSET_LOCATION:], getFontset())
 
 	return state
 }
 
+// frameBuffer returns the part of memory holding the display.
+func frameBuffer(memory []byte) []byte {
+	return memory[FRAMEBUF_LOCATION:(FRAMEBUF_LOCATION + DisplayWidth*DisplayHeight/8)]
+}
+
+func (state *State) markRow(row int) {
+	state.dirtyRows |= 1 << uint(row)
+}
+
+func (state *State) markAllRows() {
+	state.dirtyRows = 1<<DisplayHeight - 1
+}
+
+// markMemory marks the rows of the display overlapping size bytes of memory
+// written at addr.
+func (state *State) markMemory(addr uint16, size int) {
+	for i := 0; i < size; i++ {
+		offset := int(addr) + i - FRAMEBUF_LOCATION
+		if offset >= 0 && offset < len(state.FrameBuf) {
+			state.markRow(offset * 8 / DisplayWidth)
+		}
+	}
+}
+
+// takeDirtyRows returns the rows of the display changed since the last call.
+func (state *State) takeDirtyRows() []int {
+	var rows []int
+	for row := 0; row < DisplayHeight; row++ {
+		if state.dirtyRows&(1<<uint(row)) != 0 {
+			rows = append(rows, row)
+		}
+	}
+	state.dirtyRows = 0
+	return rows
+}
+
 func getFontset() []byte {
 	return []byte{
 		0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
@@ -0,0 +1,56 @@
+package emulator
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDirtyRows(t *testing.T) {
+	allRows := make([]int, DisplayHeight)
+	for i := range allRows {
+		allRows[i] = i
+	}
+
+	tests := []struct {
+		name         string
+		clip         bool
+		v0, v1       byte
+		i            uint16
+		instructions []Instruction
+		rows         []int
+	}{
+		{name: "nothing drawn"},
+		{name: "CLS", instructions: []Instruction{0x00E0}, rows: allRows},
+		// the font digit 0 is 5 rows high
+		{name: "DRW", v0: 10, v1: 3, i: 0x000, instructions: []Instruction{0xD015}, rows: []int{3, 4, 5, 6, 7}},
+		// rows of the sprite without lit pixels change nothing
+		{name: "DRW empty row", v1: 10, i: 0x300, instructions: []Instruction{0xD013}, rows: []int{10, 12}},
+		{name: "DRW wrapping", v1: 30, i: 0x000, instructions: []Instruction{0xD015}, rows: []int{0, 1, 2, 30, 31}},
+		{name: "DRW clipped", clip: true, v1: 30, i: 0x000, instructions: []Instruction{0xD015}, rows: []int{30, 31}},
+		{name: "DRW twice", v1: 8, i: 0x000, instructions: []Instruction{0xD015, 0xD015}, rows: []int{8, 9, 10, 11, 12}},
+		// a display row is 8 bytes of memory
+		{name: "LD B in the frame buffer", i: FRAMEBUF_LOCATION + 7, instructions: []Instruction{0xF033}, rows: []int{0, 1}},
+		{name: "LD B elsewhere", i: 0x300, instructions: []Instruction{0xF033}},
+		{name: "LD [I] into the frame buffer", i: FRAMEBUF_LOCATION - 2, instructions: []Instruction{0xF355}, rows: []int{0}},
+		{name: "LD [I] at the last row", i: FRAMEBUF_LOCATION + 8*DisplayHeight - 4, instructions: []Instruction{0xF355}, rows: []int{31}},
+		{name: "LD [I] elsewhere", i: 0x300, instructions: []Instruction{0xFF55}},
+	}
+
+	for _, test := range tests {
+		emu := NewEmulator()
+		state := emu.chipState
+		state.Quirks.Clip = test.clip
+		state.V[0], state.V[1], state.I = test.v0, test.v1, test.i
+		copy(state.Memory[0x300:], []byte{0xFF, 0x00, 0xFF})
+
+		for _, instruction := range test.instructions {
+			emu.executeInstruction(instruction)
+		}
+		if rows := state.takeDirtyRows(); fmt.Sprint(rows) != fmt.Sprint(test.rows) {
+			t.Errorf("%s: dirty rows %v, want %v", test.name, rows, test.rows)
+		}
+		if rows := state.takeDirtyRows(); len(rows) != 0 {
+			t.Errorf("%s: rows %v are still dirty after being taken", test.name, rows)
+		}
+	}
+}
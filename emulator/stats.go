@@ -0,0 +1,92 @@
+package emulator
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// statsWindow is how often the measured rates are updated.
+const statsWindow = time.Second
+
+// Stats is a snapshot of what the emulator is doing.
+type Stats struct {
+	Title string
+	// IPS and FPS are the instructions executed and the frames shown per
+	// second, measured over the last second.
+	IPS, FPS float64
+	// Speed is the instruction rate relative to the default one.
+	Speed     float64
+	Quirks    string // name of the quirks preset, "default" or "custom"
+	Sound     bool   // the sound timer is running
+	Paused    bool
+	Recording bool // the display is being recorded
+}
+
+// StatusView is an IO that shows the stats of the emulator. ShowStatus is
+// called every frame.
+type StatusView interface {
+	ShowStatus(stats Stats)
+}
+
+// rates counts instructions and frames to measure their rates.
+type rates struct {
+	instructions, frames int
+	since                time.Time
+	ips, fps             float64
+}
+
+// tick updates the rates once a window has passed.
+func (r *rates) tick(now time.Time) {
+	if r.since.IsZero() {
+		r.since = now
+		return
+	}
+	elapsed := now.Sub(r.since)
+	if elapsed < statsWindow {
+		return
+	}
+
+	r.ips = float64(r.instructions) / elapsed.Seconds()
+	r.fps = float64(r.frames) / elapsed.Seconds()
+	r.instructions, r.frames = 0, 0
+	r.since = now
+}
+
+// Stats returns a snapshot of the emulator's current stats.
+func (emu *Emulator) Stats() Stats {
+	title := filepath.Base(emu.romPath)
+	if emu.romEntry != nil && emu.romEntry.Program.Title != "" {
+		title = emu.romEntry.Program.Title
+	}
+
+	return Stats{
+		Title:     title,
+		IPS:       emu.rates.ips,
+		FPS:       emu.rates.fps,
+		Speed:     float64(DefaultEmuSpeed) / float64(emu.cpuPeriod),
+		Quirks:    emu.quirksPreset(),
+		Sound:     emu.chipState.Sound > 0,
+		Paused:    emu.paused,
+		Recording: emu.Recording(),
+	}
+}
+
+// quirksPreset names the quirks in use after the platform of the ROM
+// database they come from.
+func (emu *Emulator) quirksPreset() string {
+	quirks := emu.chipState.Quirks
+	switch {
+	case emu.romEntry != nil && emu.romEntry.Platform != nil && quirks == quirksFromDatabase(emu.romEntry.Quirks):
+		return emu.romEntry.Platform.Name
+	case quirks == DefaultQuirks():
+		return "default"
+	}
+	return "custom"
+}
+
+// showStatus sends the stats to the IO, if it can show them.
+func (emu *Emulator) showStatus() {
+	if view, ok := emu.io.(StatusView); ok {
+		view.ShowStatus(emu.Stats())
+	}
+}
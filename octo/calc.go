@@ -0,0 +1,122 @@
+package octo
+
+import (
+	"math"
+)
+
+var unaryOps = map[string]func(float64) float64{
+	"-":     func(x float64) float64 { return -x },
+	"~":     func(x float64) float64 { return float64(^int64(x)) },
+	"!":     func(x float64) float64 { return boolValue(x == 0) },
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"sign":  sign,
+	"ceil":  math.Ceil,
+	"floor": math.Floor,
+}
+
+var binaryOps = map[string]func(float64, float64) float64{
+	"+":   func(x, y float64) float64 { return x + y },
+	"-":   func(x, y float64) float64 { return x - y },
+	"*":   func(x, y float64) float64 { return x * y },
+	"/":   func(x, y float64) float64 { return x / y },
+	"%":   func(x, y float64) float64 { return float64(int64(x) % int64(y)) },
+	"&":   func(x, y float64) float64 { return float64(int64(x) & int64(y)) },
+	"|":   func(x, y float64) float64 { return float64(int64(x) | int64(y)) },
+	"^":   func(x, y float64) float64 { return float64(int64(x) ^ int64(y)) },
+	"<<":  func(x, y float64) float64 { return float64(int64(x) << uint(y)) },
+	">>":  func(x, y float64) float64 { return float64(int64(x) >> uint(y)) },
+	"pow": math.Pow,
+	"min": math.Min,
+	"max": math.Max,
+	"<":   func(x, y float64) float64 { return boolValue(x < y) },
+	">":   func(x, y float64) float64 { return boolValue(x > y) },
+	"<=":  func(x, y float64) float64 { return boolValue(x <= y) },
+	">=":  func(x, y float64) float64 { return boolValue(x >= y) },
+	"==":  func(x, y float64) float64 { return boolValue(x == y) },
+	"!=":  func(x, y float64) float64 { return boolValue(x != y) },
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+// calcBlock evaluates an expression up to the closing brace. Like in Octo,
+// operators have no precedence and are applied right to left, so
+// "2 * 3 + 1" is 8.
+func (c *compiler) calcBlock() float64 {
+	value := c.calcExpr()
+	c.expect("}")
+	return value
+}
+
+func (c *compiler) calcExpr() float64 {
+	value := c.calcTerm()
+	if t, ok := c.peek(); ok && !t.str {
+		if op, ok := binaryOps[t.text]; ok {
+			c.nextToken()
+			value = op(value, c.calcExpr())
+		}
+	}
+	return value
+}
+
+func (c *compiler) calcTerm() float64 {
+	t := c.nextToken()
+	switch {
+	case t.number:
+		return t.value
+	case t.str:
+		c.fail(t, "unexpected string")
+	case t.text == "(":
+		value := c.calcExpr()
+		c.expect(")")
+		return value
+	case t.text == "@":
+		// a byte of the program compiled so far
+		addr := int(c.calcTerm())
+		if addr < startAddress || addr-startAddress >= len(c.rom) {
+			c.fail(t, "@ 0x%X is outside the program", addr)
+		}
+		return float64(c.rom[addr-startAddress])
+	case t.text == "HERE":
+		return float64(c.here)
+	case t.text == "PI":
+		return math.Pi
+	case t.text == "E":
+		return math.E
+	}
+
+	if op, ok := unaryOps[t.text]; ok {
+		return op(c.calcTerm())
+	}
+	if reg, ok := c.register(t); ok {
+		return float64(reg)
+	}
+	if value, ok := c.constants[t.text]; ok {
+		return value
+	}
+	if addr, ok := c.labels[t.text]; ok {
+		return float64(addr)
+	}
+	c.fail(t, "undefined name %s", t.text)
+	return 0
+}
@@ -0,0 +1,100 @@
+package octo
+
+func (c *compiler) directive(t token) {
+	switch t.text {
+	case ":alias":
+		name := c.nextToken()
+		c.checkName(name)
+		c.aliases[name.text] = c.expectRegister()
+	case ":const":
+		name := c.nextToken()
+		c.checkName(name)
+		value, _ := c.value()
+		c.constants[name.text] = value
+	case ":calc":
+		name := c.nextToken()
+		c.checkName(name)
+		c.expect("{")
+		c.constants[name.text] = c.calcBlock()
+	case ":byte":
+		c.data = true
+		c.emit(t, c.byteValue())
+	case ":pointer":
+		c.data = true
+		addr := c.address(fixupLong, c.here)
+		c.emit(t, byte(addr>>8), byte(addr))
+	case ":call":
+		c.instruction(t, 0x2000|uint16(c.address(fixupAddr, c.here)))
+	case ":unpack":
+		// :unpack nibble label loads v0 and v1 with the nibble and a 12 bit address
+		nibble := c.number(0, 15)
+		pending := len(c.fixups)
+		addr := c.address(fixupUnpack, c.here)
+		if len(c.fixups) > pending {
+			c.fixups[pending].nibble = nibble
+		}
+		c.instruction(t, 0x6000|uint16(nibble<<4|addr>>8&0xF))
+		c.instruction(t, 0x6100|uint16(addr&0xFF))
+	case ":next":
+		// names the second byte of the next instruction, to modify its operand
+		c.defineLabel(c.nextToken(), c.here+1)
+	case ":org":
+		c.here = c.number(startAddress, memorySize-1)
+	case ":macro":
+		c.defineMacro()
+	case ":assert":
+		message := ""
+		if next, ok := c.peek(); ok && next.str {
+			message = c.nextToken().text
+		}
+		c.expect("{")
+		if c.calcBlock() == 0 {
+			if message == "" {
+				message = "assertion failed"
+			}
+			c.fail(t, "%s", message)
+		}
+	case ":breakpoint":
+		c.nextToken()
+	case ":monitor":
+		c.nextToken()
+		c.nextToken()
+	case ":stringmode":
+		c.fail(t, ":stringmode is not supported")
+	default:
+		c.fail(t, "unknown directive %s", t.text)
+	}
+}
+
+// :macro name param ... { body }
+func (c *compiler) defineMacro() {
+	name := c.nextToken()
+	c.checkName(name)
+	if _, ok := c.macros[name.text]; ok {
+		c.fail(name, "the macro %s has already been defined", name.text)
+	}
+
+	m := &macro{}
+	for !c.peekIs("{") {
+		m.params = append(m.params, c.nextToken().text)
+	}
+	open := c.nextToken()
+
+	for depth := 1; ; {
+		if c.next >= len(c.tokens) {
+			c.fail(open, "the body of %s has no closing }", name.text)
+		}
+		t := c.nextToken()
+		if !t.str && t.text == "{" {
+			depth++
+		}
+		if !t.str && t.text == "}" {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+		m.body = append(m.body, t)
+	}
+	c.macros[name.text] = m
+}
@@ -0,0 +1,447 @@
+// Package octo compiles programs written in Octo, the high level assembly
+// language of the Octo IDE (https://github.com/JohnEarnest/Octo).
+//
+// Everything but :stringmode is supported: the statements, if/then,
+// if/begin/else/end, loop/while/again, :alias, :const, :calc, :byte,
+// :pointer, :unpack, :next, :org, :macro, :call and :assert. :breakpoint and
+// :monitor are accepted and ignored.
+package octo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kopi22/chip8/symbols"
+)
+
+const (
+	startAddress = 0x200
+	// XO-CHIP programs may use up to 64K
+	memorySize = 0x10000
+)
+
+// Error is a compilation error. Octo stops at the first one.
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+// Program is a compiled ROM, to be loaded at 0x200.
+type Program struct {
+	Rom     []byte
+	Symbols *symbols.Map
+}
+
+type token struct {
+	text string
+	str  bool // quoted string
+	line int
+	col  int
+	// use is the line of the outermost macro use a token was expanded
+	// from, which the symbol map shows, or 0
+	use    int
+	number bool
+	value  float64
+}
+
+// sourceLine returns the line the symbol map shows for the token.
+func (t token) sourceLine() int {
+	if t.use != 0 {
+		return t.use
+	}
+	return t.line
+}
+
+type fixupKind int
+
+const (
+	fixupAddr   fixupKind = iota // 12 bit address in the low bits of an opcode
+	fixupLong                    // 16 bit address
+	fixupUnpack                  // v0 := nibble|hi, v1 := lo
+)
+
+// fixup patches a reference to a label defined later.
+type fixup struct {
+	kind   fixupKind
+	addr   int
+	name   token
+	nibble int
+}
+
+type macro struct {
+	params []string
+	body   []token
+	calls  int
+}
+
+type frameKind int
+
+const (
+	frameBegin frameKind = iota
+	frameLoop
+)
+
+// frame is an open begin or loop block.
+type frame struct {
+	kind  frameKind
+	at    token
+	addr  int   // loop start, or jump to patch for begin
+	jumps []int // while exits of a loop
+}
+
+type compiler struct {
+	filename string
+	tokens   []token
+	next     int
+
+	rom    []byte // memory from 0x200
+	here   int
+	labels map[string]int
+	order  []string
+
+	constants map[string]float64
+	aliases   map[string]int
+	macros    map[string]*macro
+	fixups    []fixup
+	frames    []*frame
+
+	jumpToMain bool
+	// data is set by statements emitting data rather than code
+	data  bool
+	lines *symbols.Map
+}
+
+// Compile compiles Octo source, using filename in errors and source lines.
+// Like Octo, a program not starting with ": main" begins with a jump to main.
+func Compile(filename, source string) (program *Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			compileErr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			program, err = nil, compileErr
+		}
+	}()
+
+	tokens, err := tokenize(filename, source)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{
+		filename:   filename,
+		tokens:     tokens,
+		rom:        []byte{0x00, 0x00}, // reserved for the jump to main
+		here:       startAddress + 2,
+		labels:     make(map[string]int),
+		constants:  make(map[string]float64),
+		aliases:    make(map[string]int),
+		macros:     make(map[string]*macro),
+		jumpToMain: true,
+		lines:      &symbols.Map{},
+	}
+	for i, key := range "X123QWEASDZC4RFV" {
+		c.constants["OCTO_KEY_"+string(key)] = float64(i)
+	}
+	return c.compile(), nil
+}
+
+func (c *compiler) compile() *Program {
+	for c.next < len(c.tokens) {
+		t, start := c.tokens[c.next], c.here
+		c.data = false
+		c.statement()
+		if size := c.here - start; size > 0 && t.text != ":org" {
+			c.lines.AddLine(uint16(start), size, c.filename, t.sourceLine())
+			if c.data {
+				c.lines.AddData(uint16(start), size)
+			}
+		}
+	}
+
+	if len(c.frames) > 0 {
+		open := c.frames[len(c.frames)-1]
+		c.fail(open.at, "%s has no matching %s", open.at.text, map[frameKind]string{frameBegin: "end", frameLoop: "again"}[open.kind])
+	}
+	main, ok := c.labels["main"]
+	if !ok {
+		c.fail(token{line: 1, col: 1}, "this program is missing a main label")
+	}
+	if c.jumpToMain {
+		c.patch(startAddress, 0x1000|uint16(main))
+	}
+
+	for _, f := range c.fixups {
+		addr, ok := c.labels[f.name.text]
+		if !ok {
+			c.fail(f.name, "undefined name %s", f.name.text)
+		}
+		c.resolve(f, addr)
+	}
+
+	syms := c.lines
+	for _, name := range c.order {
+		syms.AddLabel(name, uint16(c.labels[name]))
+	}
+	return &Program{Rom: c.rom, Symbols: syms}
+}
+
+func (c *compiler) fail(at token, format string, args ...interface{}) {
+	panic(&Error{File: c.filename, Line: at.line, Column: at.col, Msg: fmt.Sprintf(format, args...)})
+}
+
+// tokenize splits the source at white space. Comments start with '#'.
+func tokenize(filename, source string) ([]token, error) {
+	var tokens []token
+	for lineNo, line := range strings.Split(source, "\n") {
+		for i := 0; i < len(line); {
+			switch c := line[i]; {
+			case c == '#':
+				i = len(line)
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case c == '"':
+				end := strings.IndexByte(line[i+1:], '"')
+				if end < 0 {
+					return nil, &Error{File: filename, Line: lineNo + 1, Column: i + 1, Msg: "missing closing quote"}
+				}
+				tokens = append(tokens, token{text: line[i+1 : i+1+end], str: true, line: lineNo + 1, col: i + 1})
+				i += end + 2
+			default:
+				end := i
+				for end < len(line) && !strings.ContainsRune(" \t\r#", rune(line[end])) {
+					end++
+				}
+				t := token{text: line[i:end], line: lineNo + 1, col: i + 1}
+				t.value, t.number = parseNumber(t.text)
+				tokens = append(tokens, t)
+				i = end
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// parseNumber parses decimal, 0x hex and 0b binary numbers, with an optional
+// minus sign.
+func parseNumber(text string) (float64, bool) {
+	s, sign := text, 1.0
+	if strings.HasPrefix(s, "-") {
+		s, sign = s[1:], -1
+	}
+
+	var value int64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		value, err = strconv.ParseInt(s[2:], 16, 64)
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		value, err = strconv.ParseInt(s[2:], 2, 64)
+	default:
+		value, err = strconv.ParseInt(s, 10, 64)
+	}
+	if err != nil {
+		return 0, false
+	}
+	return sign * float64(value), true
+}
+
+func (c *compiler) peek() (token, bool) {
+	if c.next >= len(c.tokens) {
+		return token{}, false
+	}
+	return c.tokens[c.next], true
+}
+
+func (c *compiler) nextToken() token {
+	if c.next >= len(c.tokens) {
+		last := token{line: 1, col: 1}
+		if len(c.tokens) > 0 {
+			last = c.tokens[len(c.tokens)-1]
+		}
+		c.fail(last, "unexpected end of file")
+	}
+	t := c.tokens[c.next]
+	c.next++
+	return t
+}
+
+func (c *compiler) expect(text string) token {
+	t := c.nextToken()
+	if t.text != text || t.str {
+		c.fail(t, "expected %s, found %s", text, t.text)
+	}
+	return t
+}
+
+func (c *compiler) peekIs(text string) bool {
+	t, ok := c.peek()
+	return ok && !t.str && t.text == text
+}
+
+// emit writes bytes at the current address, growing the ROM as needed.
+func (c *compiler) emit(at token, bytes ...byte) {
+	for _, b := range bytes {
+		if c.here >= memorySize {
+			c.fail(at, "program does not fit in memory")
+		}
+		for len(c.rom) <= c.here-startAddress {
+			c.rom = append(c.rom, 0)
+		}
+		c.rom[c.here-startAddress] = b
+		c.here++
+	}
+}
+
+func (c *compiler) instruction(at token, opcode uint16) {
+	c.emit(at, byte(opcode>>8), byte(opcode))
+}
+
+func (c *compiler) patch(addr int, opcode uint16) {
+	c.rom[addr-startAddress] = byte(opcode >> 8)
+	c.rom[addr-startAddress+1] = byte(opcode)
+}
+
+func (c *compiler) word(addr int) uint16 {
+	return uint16(c.rom[addr-startAddress])<<8 | uint16(c.rom[addr-startAddress+1])
+}
+
+func (c *compiler) resolve(f fixup, addr int) {
+	switch f.kind {
+	case fixupAddr:
+		if addr > 0xFFF {
+			c.fail(f.name, "%s is at 0x%X, out of reach of a 12 bit address", f.name.text, addr)
+		}
+		c.patch(f.addr, c.word(f.addr)&0xF000|uint16(addr))
+	case fixupLong:
+		c.patch(f.addr, uint16(addr))
+	case fixupUnpack:
+		c.patch(f.addr, 0x6000|uint16(f.nibble<<4|addr>>8&0xF))
+		c.patch(f.addr+2, 0x6100|uint16(addr&0xFF))
+	}
+}
+
+func (c *compiler) defineLabel(name token, addr int) {
+	c.checkName(name)
+	if _, ok := c.labels[name.text]; ok {
+		c.fail(name, "the name %s has already been defined", name.text)
+	}
+
+	if name.text == "main" && c.here == startAddress+2 && len(c.labels) == 0 && len(c.fixups) == 0 && addr == c.here {
+		// the program starts with main, no jump needed
+		c.rom = c.rom[:0]
+		c.here, addr = startAddress, startAddress
+		c.jumpToMain = false
+	}
+	c.labels[name.text] = addr
+	c.order = append(c.order, name.text)
+}
+
+func (c *compiler) checkName(name token) {
+	if name.number || name.str {
+		c.fail(name, "%s is not a valid name", name.text)
+	}
+	if _, ok := c.register(name); ok || keywords[name.text] {
+		c.fail(name, "%s is a reserved name", name.text)
+	}
+	if _, ok := c.constants[name.text]; ok {
+		c.fail(name, "the name %s has already been defined", name.text)
+	}
+}
+
+// register parses v0-vf and aliases.
+func (c *compiler) register(t token) (int, bool) {
+	if reg, ok := c.aliases[t.text]; ok && !t.str {
+		return reg, true
+	}
+	if len(t.text) != 2 || t.str || t.text[0] != 'v' && t.text[0] != 'V' {
+		return 0, false
+	}
+	reg, err := strconv.ParseUint(t.text[1:], 16, 4)
+	if err != nil {
+		return 0, false
+	}
+	return int(reg), true
+}
+
+func (c *compiler) expectRegister() int {
+	t := c.nextToken()
+	reg, ok := c.register(t)
+	if !ok {
+		c.fail(t, "expected a register, found %s", t.text)
+	}
+	return reg
+}
+
+func (c *compiler) peekRegister() bool {
+	t, ok := c.peek()
+	if !ok {
+		return false
+	}
+	_, ok = c.register(t)
+	return ok
+}
+
+// value reads a number, constant, label or { expression }.
+func (c *compiler) value() (float64, token) {
+	t := c.nextToken()
+	switch {
+	case t.number:
+		return t.value, t
+	case t.str:
+		c.fail(t, "expected a value, found a string")
+	case t.text == "{":
+		return c.calcBlock(), t
+	}
+	if value, ok := c.constants[t.text]; ok {
+		return value, t
+	}
+	if addr, ok := c.labels[t.text]; ok {
+		return float64(addr), t
+	}
+	c.fail(t, "undefined name %s", t.text)
+	return 0, t
+}
+
+// number reads a value that has to be within min and max.
+func (c *compiler) number(min, max int) int {
+	value, t := c.value()
+	n := int(value)
+	if n < min || n > max {
+		c.fail(t, "value %s is outside %d-%d", t.text, min, max)
+	}
+	return n
+}
+
+func (c *compiler) byteValue() byte {
+	return byte(c.number(-128, 255))
+}
+
+// address reads a value or a label, possibly defined later, in which case
+// the bytes at addr are patched once it is.
+func (c *compiler) address(kind fixupKind, addr int) int {
+	t, _ := c.peek()
+	if !t.number && !t.str && t.text != "{" {
+		if _, isConst := c.constants[t.text]; !isConst {
+			if _, defined := c.labels[t.text]; !defined {
+				c.nextToken()
+				c.checkName(t)
+				c.fixups = append(c.fixups, fixup{kind: kind, addr: addr, name: t})
+				return 0
+			}
+		}
+	}
+
+	if kind == fixupLong {
+		return c.number(0, 0xFFFF)
+	}
+	return c.number(0, 0xFFF)
+}
@@ -0,0 +1,113 @@
+package octo
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		source string
+		rom    []byte
+	}{
+		{"clear", []byte{0x00, 0xE0}},
+		{"return", []byte{0x00, 0xEE}},
+		{";", []byte{0x00, 0xEE}},
+		{"v1 := 5", []byte{0x61, 0x05}},
+		{"v1 += 0xFF", []byte{0x71, 0xFF}},
+		{"v1 := v2", []byte{0x81, 0x20}},
+		{"v1 |= v2", []byte{0x81, 0x21}},
+		{"v1 &= v2", []byte{0x81, 0x22}},
+		{"v1 ^= v2", []byte{0x81, 0x23}},
+		{"v1 += v2", []byte{0x81, 0x24}},
+		{"v1 -= v2", []byte{0x81, 0x25}},
+		{"v1 >>= v2", []byte{0x81, 0x26}},
+		{"v1 =- v2", []byte{0x81, 0x27}},
+		{"v1 <<= v2", []byte{0x81, 0x2E}},
+		{"v1 := random 0x0F", []byte{0xC1, 0x0F}},
+		{"v1 := delay", []byte{0xF1, 0x07}},
+		{"v1 := key", []byte{0xF1, 0x0A}},
+		{"delay := v1", []byte{0xF1, 0x15}},
+		{"buzzer := v1", []byte{0xF1, 0x18}},
+		{"i := 0x345", []byte{0xA3, 0x45}},
+		{"i += v3", []byte{0xF3, 0x1E}},
+		{"i := hex v1", []byte{0xF1, 0x29}},
+		{"i := bighex v1", []byte{0xF1, 0x30}},
+		{"bcd v1", []byte{0xF1, 0x33}},
+		{"save v3", []byte{0xF3, 0x55}},
+		{"load v3", []byte{0xF3, 0x65}},
+		{"saveflags v3", []byte{0xF3, 0x75}},
+		{"loadflags v3", []byte{0xF3, 0x85}},
+		{"sprite v1 v2 5", []byte{0xD1, 0x25}},
+		{"jump 0x300", []byte{0x13, 0x00}},
+		{"jump0 0x300", []byte{0xB3, 0x00}},
+		{"native 0x123", []byte{0x01, 0x23}},
+		{"if v1 == 5 then clear", []byte{0x41, 0x05, 0x00, 0xE0}},
+		{"if v1 != v2 then clear", []byte{0x51, 0x20, 0x00, 0xE0}},
+		{"if v1 key then clear", []byte{0xE1, 0xA1, 0x00, 0xE0}},
+		{"if v1 -key then clear", []byte{0xE1, 0x9E, 0x00, 0xE0}},
+		{"hires", []byte{0x00, 0xFF}},
+		{"lores", []byte{0x00, 0xFE}},
+		{"scroll-down 3", []byte{0x00, 0xC3}},
+		{"scroll-right", []byte{0x00, 0xFB}},
+		{"exit", []byte{0x00, 0xFD}},
+		{"plane 3", []byte{0xF3, 0x01}},
+		{"audio", []byte{0xF0, 0x02}},
+		{"1 2 0xFF", []byte{0x01, 0x02, 0xFF}},
+		{":const N 7 v0 := N", []byte{0x60, 0x07}},
+		{":alias x v3 x := 1", []byte{0x63, 0x01}},
+		// :calc evaluates from right to left
+		{":calc N { 2 * 3 + 1 } v0 := N", []byte{0x60, 0x08}},
+	}
+
+	for _, test := range tests {
+		program, err := Compile("test.8o", ": main "+test.source)
+		if err != nil {
+			t.Errorf("%q: %v", test.source, err)
+			continue
+		}
+		// main comes first, so there is no jump to it
+		if !bytes.Equal(program.Rom, test.rom) {
+			t.Errorf("%q compiled to % X, want % X", test.source, program.Rom, test.rom)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{": main\n  v1 := 0x100", "test.8o:2:9: value 0x100 is outside -128-255"},
+		{": main\n  jump missing", "test.8o:2:8: undefined name missing"},
+		{": main\n  loop", "test.8o:2:3: loop has no matching again"},
+		{": main\n  again", "test.8o:2:3: again without a matching loop"},
+		{"clear", "test.8o:1:1: this program is missing a main label"},
+		{": main\n: main", "test.8o:2:3: the name main has already been defined"},
+		{": main\n  v1 := \"x\"", "test.8o:2:9: expected a value, found a string"},
+		{": main\n  sprite v1 v2 16", "test.8o:2:16: value 16 is outside 0-15"},
+	}
+
+	for _, test := range tests {
+		_, err := Compile("test.8o", test.source)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %s", test.source, err, test.err)
+		}
+	}
+}
+
+func TestMacroLines(t *testing.T) {
+	source := ": main\n:macro twice r {\n  r += 1\n  r += 1\n}\n  v0 := 0\n  twice v0\n"
+	program, err := Compile("test.8o", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[uint16]int{0x200: 6, 0x202: 7, 0x204: 7}
+	for addr, line := range want {
+		source, ok := program.Symbols.Source(addr)
+		if !ok || source.Line != line {
+			t.Errorf("0x%03X maps to %v, want line %d", addr, source, line)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package octo
+
+import (
+	"strconv"
+)
+
+// keywords can't be used as names.
+var keywords = map[string]bool{
+	"return": true, ";": true, "clear": true, "bcd": true, "save": true, "load": true,
+	"sprite": true, "jump": true, "jump0": true, "native": true, "delay": true,
+	"buzzer": true, "pitch": true, "i": true, "if": true, "then": true, "begin": true,
+	"else": true, "end": true, "loop": true, "while": true, "again": true, "key": true,
+	"-key": true, "hex": true, "bighex": true, "long": true, "random": true,
+	"saveflags": true, "loadflags": true, "scroll-down": true, "scroll-up": true,
+	"scroll-left": true, "scroll-right": true, "exit": true, "lores": true, "hires": true,
+	"plane": true, "audio": true, ":=": true, "+=": true, "-=": true, "=-": true,
+	"|=": true, "&=": true, "^=": true, ">>=": true, "<<=": true, "==": true, "!=": true,
+	"<": true, ">": true, "<=": true, ">=": true, "{": true, "}": true, ":": true,
+}
+
+// simpleStatements are the statements without operands.
+var simpleStatements = map[string]uint16{
+	"clear":        0x00E0,
+	"return":       0x00EE,
+	";":            0x00EE,
+	"scroll-right": 0x00FB,
+	"scroll-left":  0x00FC,
+	"exit":         0x00FD,
+	"lores":        0x00FE,
+	"hires":        0x00FF,
+	"audio":        0xF002,
+}
+
+// registerStatements take a single register, encoded in the X nibble.
+var registerStatements = map[string]uint16{
+	"bcd":       0xF033,
+	"saveflags": 0xF075,
+	"loadflags": 0xF085,
+}
+
+// aluOps are the vx op vy instructions, encoded as 8xyN.
+var aluOps = map[string]uint16{
+	":=":  0x0,
+	"|=":  0x1,
+	"&=":  0x2,
+	"^=":  0x3,
+	"+=":  0x4,
+	"-=":  0x5,
+	">>=": 0x6,
+	"=-":  0x7,
+	"<<=": 0xE,
+}
+
+var negated = map[string]string{
+	"==": "!=", "!=": "==", "key": "-key", "-key": "key",
+	"<": ">=", ">=": "<", ">": "<=", "<=": ">",
+}
+
+func (c *compiler) statement() {
+	t := c.nextToken()
+	if t.number {
+		c.data = true
+		c.emit(t, byte(c.checkByte(t, t.value)))
+		return
+	}
+	if t.str {
+		c.fail(t, "unexpected string")
+	}
+
+	if opcode, ok := simpleStatements[t.text]; ok {
+		c.instruction(t, opcode)
+		return
+	}
+	if opcode, ok := registerStatements[t.text]; ok {
+		c.instruction(t, opcode|uint16(c.expectRegister())<<8)
+		return
+	}
+	if _, ok := c.register(t); ok {
+		c.next--
+		c.assignment()
+		return
+	}
+
+	switch t.text {
+	case "save", "load":
+		x := c.expectRegister()
+		if c.peekIs("-") {
+			// XO-CHIP range
+			c.nextToken()
+			y := c.expectRegister()
+			opcode := uint16(0x5002)
+			if t.text == "load" {
+				opcode = 0x5003
+			}
+			c.instruction(t, opcode|uint16(x)<<8|uint16(y)<<4)
+			return
+		}
+		opcode := uint16(0xF055)
+		if t.text == "load" {
+			opcode = 0xF065
+		}
+		c.instruction(t, opcode|uint16(x)<<8)
+	case "sprite":
+		x := c.expectRegister()
+		y := c.expectRegister()
+		n := c.number(0, 15)
+		c.instruction(t, 0xD000|uint16(x)<<8|uint16(y)<<4|uint16(n))
+	case "jump":
+		c.instruction(t, 0x1000|uint16(c.address(fixupAddr, c.here)))
+	case "jump0":
+		c.instruction(t, 0xB000|uint16(c.address(fixupAddr, c.here)))
+	case "native":
+		c.instruction(t, uint16(c.address(fixupAddr, c.here)))
+	case "scroll-down":
+		c.instruction(t, 0x00C0|uint16(c.number(0, 15)))
+	case "scroll-up":
+		c.instruction(t, 0x00D0|uint16(c.number(0, 15)))
+	case "plane":
+		c.instruction(t, 0xF001|uint16(c.number(0, 15))<<8)
+	case "delay", "buzzer", "pitch":
+		c.expect(":=")
+		opcode := map[string]uint16{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}[t.text]
+		c.instruction(t, opcode|uint16(c.expectRegister())<<8)
+	case "i":
+		c.indexAssignment(t)
+	case "if":
+		c.ifStatement(t)
+	case "else":
+		f := c.closeFrame(t, frameBegin)
+		c.frames = append(c.frames, &frame{kind: frameBegin, at: t, addr: c.here})
+		c.instruction(t, 0x1000)
+		c.patch(f.addr, 0x1000|uint16(c.here))
+	case "end":
+		f := c.closeFrame(t, frameBegin)
+		c.patch(f.addr, 0x1000|uint16(c.here))
+	case "loop":
+		c.frames = append(c.frames, &frame{kind: frameLoop, at: t, addr: c.here})
+	case "while":
+		f := c.innermostLoop(t)
+		c.conditional(true)
+		f.jumps = append(f.jumps, c.here)
+		c.instruction(t, 0x1000)
+	case "again":
+		f := c.closeFrame(t, frameLoop)
+		c.instruction(t, 0x1000|uint16(f.addr))
+		for _, jump := range f.jumps {
+			c.patch(jump, 0x1000|uint16(c.here))
+		}
+	case ":":
+		c.defineLabel(c.nextToken(), c.here)
+	default:
+		if t.text[0] == ':' {
+			c.directive(t)
+			return
+		}
+		c.identifier(t)
+	}
+}
+
+// identifier handles a bare name: a macro, a constant emitted as a byte, or
+// a call of a subroutine.
+func (c *compiler) identifier(t token) {
+	if m, ok := c.macros[t.text]; ok {
+		c.expand(t, m)
+		return
+	}
+	if value, ok := c.constants[t.text]; ok {
+		c.data = true
+		c.emit(t, byte(c.checkByte(t, value)))
+		return
+	}
+	c.next--
+	c.instruction(t, 0x2000|uint16(c.address(fixupAddr, c.here)))
+}
+
+func (c *compiler) checkByte(t token, value float64) int {
+	n := int(value)
+	if n < -128 || n > 255 {
+		c.fail(t, "value %s is outside -128-255", t.text)
+	}
+	return n
+}
+
+// vx op value
+func (c *compiler) assignment() {
+	x := c.expectRegister()
+	op := c.nextToken()
+	opcode := uint16(x) << 8
+
+	switch {
+	case op.text == ":=" && c.peekIs("key"):
+		c.nextToken()
+		c.instruction(op, 0xF00A|opcode)
+	case op.text == ":=" && c.peekIs("delay"):
+		c.nextToken()
+		c.instruction(op, 0xF007|opcode)
+	case op.text == ":=" && c.peekIs("random"):
+		c.nextToken()
+		c.instruction(op, 0xC000|opcode|uint16(c.byteValue()))
+	case c.peekRegister():
+		alu, ok := aluOps[op.text]
+		if !ok {
+			c.fail(op, "%s is not an operator", op.text)
+		}
+		c.instruction(op, 0x8000|opcode|uint16(c.expectRegister())<<4|alu)
+	case op.text == ":=":
+		c.instruction(op, 0x6000|opcode|uint16(c.byteValue()))
+	case op.text == "+=":
+		c.instruction(op, 0x7000|opcode|uint16(c.byteValue()))
+	case op.text == "-=":
+		c.instruction(op, 0x7000|opcode|uint16(-int(c.byteValue()))&0xFF)
+	default:
+		c.fail(op, "%s needs a register", op.text)
+	}
+}
+
+// i := ... or i += vx
+func (c *compiler) indexAssignment(t token) {
+	op := c.nextToken()
+	switch {
+	case op.text == "+=":
+		c.instruction(t, 0xF01E|uint16(c.expectRegister())<<8)
+	case op.text != ":=":
+		c.fail(op, "expected := or +=, found %s", op.text)
+	case c.peekIs("hex"):
+		c.nextToken()
+		c.instruction(t, 0xF029|uint16(c.expectRegister())<<8)
+	case c.peekIs("bighex"):
+		c.nextToken()
+		c.instruction(t, 0xF030|uint16(c.expectRegister())<<8)
+	case c.peekIs("long"):
+		c.nextToken()
+		addr := c.address(fixupLong, c.here+2)
+		c.instruction(t, 0xF000)
+		c.instruction(t, uint16(addr))
+	default:
+		c.instruction(t, 0xA000|uint16(c.address(fixupAddr, c.here)))
+	}
+}
+
+// if condition then statement, or if condition begin ... [else ...] end
+func (c *compiler) ifStatement(t token) {
+	// the condition is "vx key", "vx -key" or "vx op value"
+	length := 3
+	if c.next+1 < len(c.tokens) && (c.tokens[c.next+1].text == "key" || c.tokens[c.next+1].text == "-key") {
+		length = 2
+	}
+	block := c.next+length < len(c.tokens) && c.tokens[c.next+length].text == "begin"
+
+	// a block is entered by skipping the jump over it
+	c.conditional(block)
+	switch body := c.nextToken(); body.text {
+	case "then":
+	case "begin":
+		c.frames = append(c.frames, &frame{kind: frameBegin, at: body, addr: c.here})
+		c.instruction(body, 0x1000)
+	default:
+		c.fail(body, "expected then or begin, found %s", body.text)
+	}
+}
+
+// conditional compiles "vx op value" so that the next instruction runs only
+// when the condition holds, or when it does not if negate is set. The
+// comparisons Octo adds to CHIP-8 are computed in vf.
+func (c *compiler) conditional(negate bool) {
+	x := c.expectRegister()
+	op := c.nextToken()
+	cond, ok := negated[op.text]
+	if !ok {
+		c.fail(op, "%s is not a comparison", op.text)
+	}
+	if !negate {
+		cond = op.text
+	}
+	opcode := uint16(x) << 8
+
+	// the emitted skip has to skip when the condition is false
+	switch cond {
+	case "key":
+		c.instruction(op, 0xE0A1|opcode)
+	case "-key":
+		c.instruction(op, 0xE09E|opcode)
+	case "==", "!=":
+		skipRegister, skipByte := uint16(0x9000), uint16(0x4000)
+		if cond == "!=" {
+			skipRegister, skipByte = 0x5000, 0x3000
+		}
+		if c.peekRegister() {
+			c.instruction(op, skipRegister|opcode|uint16(c.expectRegister())<<4)
+		} else {
+			c.instruction(op, skipByte|opcode|uint16(c.byteValue()))
+		}
+	default:
+		// vf := value, then vf -= vx or vf =- vx leaves the carry in vf
+		if c.peekRegister() {
+			c.instruction(op, 0x8F00|uint16(c.expectRegister())<<4)
+		} else {
+			c.instruction(op, 0x6F00|uint16(c.byteValue()))
+		}
+		switch cond {
+		case ">": // vf = value >= vx
+			c.instruction(op, 0x8F05|uint16(x)<<4)
+			c.instruction(op, 0x4F00)
+		case "<=":
+			c.instruction(op, 0x8F05|uint16(x)<<4)
+			c.instruction(op, 0x3F00)
+		case "<": // vf = vx >= value
+			c.instruction(op, 0x8F07|uint16(x)<<4)
+			c.instruction(op, 0x4F00)
+		case ">=":
+			c.instruction(op, 0x8F07|uint16(x)<<4)
+			c.instruction(op, 0x3F00)
+		}
+	}
+}
+
+func (c *compiler) closeFrame(t token, kind frameKind) *frame {
+	if len(c.frames) == 0 || c.frames[len(c.frames)-1].kind != kind {
+		c.fail(t, "%s without a matching %s", t.text, map[frameKind]string{frameBegin: "begin", frameLoop: "loop"}[kind])
+	}
+	f := c.frames[len(c.frames)-1]
+	c.frames = c.frames[:len(c.frames)-1]
+	return f
+}
+
+func (c *compiler) innermostLoop(t token) *frame {
+	for i := len(c.frames) - 1; i >= 0; i-- {
+		if c.frames[i].kind == frameLoop {
+			return c.frames[i]
+		}
+	}
+	c.fail(t, "while outside of a loop")
+	return nil
+}
+
+// maxTokens stops runaway recursive macros.
+const maxTokens = 1 << 20
+
+// expand replaces a macro use by the body of the macro.
+func (c *compiler) expand(t token, m *macro) {
+	bindings := make(map[string]token)
+	for _, param := range m.params {
+		bindings[param] = c.nextToken()
+	}
+	bindings["CALLS"] = token{text: strconv.Itoa(m.calls), number: true, value: float64(m.calls)}
+	m.calls++
+
+	if len(c.tokens) > maxTokens {
+		c.fail(t, "macro expansion is too large, is %s recursive?", t.text)
+	}
+	body := make([]token, len(m.body))
+	for i, b := range m.body {
+		body[i] = b
+		if arg, ok := bindings[b.text]; ok && !b.str {
+			body[i] = arg
+			body[i].line, body[i].col = b.line, b.col
+		}
+		body[i].use = t.sourceLine()
+	}
+
+	rest := c.tokens[c.next:]
+	c.tokens = append(append(c.tokens[:c.next:c.next], body...), rest...)
+}
@@ -0,0 +1,223 @@
+// Package profiler counts the instructions a CHIP-8 program executes and
+// writes them as a pprof profile, so that "go tool pprof" can show top lists
+// and flame graphs of the program's subroutines.
+package profiler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/symbols"
+)
+
+const maxDepth = 16
+
+// frame is a PC within the subroutine starting at routine.
+type frame struct {
+	routine uint16
+	pc      uint16
+}
+
+type sample struct {
+	stack []frame // innermost first
+	count int64
+}
+
+// Profiler is an emulator.Observer counting executions per PC and call stack.
+type Profiler struct {
+	// routines holds the entry of the subroutine running at each call depth,
+	// learned from the CALL instructions, as State.Stack only keeps the
+	// return addresses.
+	routines [maxDepth + 1]uint16
+	samples  map[string]*sample
+	start    time.Time
+	period   time.Duration
+}
+
+func New() *Profiler {
+	p := &Profiler{
+		samples: make(map[string]*sample),
+		start:   time.Now(),
+		period:  emulator.DefaultEmuSpeed,
+	}
+	p.routines[0] = emulator.INITIAL_PC
+	return p
+}
+
+// SetPeriod sets the time an instruction takes, used to show durations next
+// to the instruction counts.
+func (p *Profiler) SetPeriod(period time.Duration) *Profiler {
+	p.period = period
+	return p
+}
+
+func (p *Profiler) BeforeExecute(state *emulator.State, instruction emulator.Instruction) {
+	depth := int(state.SP)
+	if depth > maxDepth {
+		depth = maxDepth
+	}
+	if instruction>>12 == 0x2 && depth < maxDepth {
+		defer func() { p.routines[depth+1] = instruction.GetNNN() }()
+	}
+
+	// the stack is recorded innermost first: the PC, then the call sites
+	key := make([]byte, 0, 4*(depth+1))
+	stack := []frame{{routine: p.routines[depth], pc: state.PC}}
+	for i := depth - 1; i >= 0; i-- {
+		stack = append(stack, frame{routine: p.routines[i], pc: state.Stack[i] - 2})
+	}
+	for _, f := range stack {
+		key = append(key, byte(f.routine>>8), byte(f.routine), byte(f.pc>>8), byte(f.pc))
+	}
+
+	s := p.samples[string(key)]
+	if s == nil {
+		s = &sample{stack: stack}
+		p.samples[string(key)] = s
+	}
+	s.count++
+}
+
+// routineName names a subroutine after its label in the symbol map.
+func routineName(entry uint16, syms *symbols.Map) string {
+	if label, ok := syms.Label(entry); ok {
+		return label
+	}
+	if entry == emulator.INITIAL_PC {
+		return "main"
+	}
+	return fmt.Sprintf("sub_%03X", entry)
+}
+
+// Write writes the profile in the gzipped protocol buffer format of pprof.
+// The symbol map, which may be nil, names the subroutines and gives the
+// source lines of the instructions.
+func (p *Profiler) Write(w io.Writer, romName string, syms *symbols.Map) error {
+	strings := map[string]int64{"": 0}
+	stringTable := []string{""}
+	str := func(s string) int64 {
+		if i, ok := strings[s]; ok {
+			return i
+		}
+		strings[s] = int64(len(stringTable))
+		stringTable = append(stringTable, s)
+		return strings[s]
+	}
+
+	var profile protoBuffer
+	for _, valueType := range [][2]string{{"instructions", "count"}, {"cpu", "nanoseconds"}} {
+		var vt protoBuffer
+		vt.int64Field(1, str(valueType[0]))
+		vt.int64Field(2, str(valueType[1]))
+		profile.messageField(1, &vt) // sample_type
+	}
+
+	functions := make(map[uint16]uint64)
+	locations := make(map[frame]uint64)
+	var functionMsgs, locationMsgs []*protoBuffer
+	locationID := func(f frame) uint64 {
+		if id, ok := locations[f]; ok {
+			return id
+		}
+
+		fnID, ok := functions[f.routine]
+		if !ok {
+			fnID = uint64(len(functions) + 1)
+			functions[f.routine] = fnID
+			var fn protoBuffer
+			fn.uint64Field(1, fnID)
+			fn.int64Field(2, str(routineName(f.routine, syms)))
+			fn.int64Field(3, str(fmt.Sprintf("0x%03X", f.routine)))
+			if line, ok := syms.Source(f.routine); ok {
+				fn.int64Field(4, str(line.File))
+				fn.int64Field(5, int64(line.Line))
+			}
+			functionMsgs = append(functionMsgs, &fn)
+		}
+
+		id := uint64(len(locations) + 1)
+		locations[f] = id
+		var line protoBuffer
+		line.uint64Field(1, fnID)
+		if source, ok := syms.Source(f.pc); ok {
+			line.int64Field(2, int64(source.Line))
+		}
+		var loc protoBuffer
+		loc.uint64Field(1, id)
+		loc.uint64Field(2, 1) // mapping
+		loc.uint64Field(3, uint64(f.pc))
+		loc.messageField(4, &line)
+		locationMsgs = append(locationMsgs, &loc)
+		return id
+	}
+
+	// samples in a stable order, so equal runs give equal files
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := p.samples[key]
+		ids := make([]uint64, len(s.stack))
+		for i, f := range s.stack {
+			ids[i] = locationID(f)
+		}
+		var msg protoBuffer
+		msg.packedField(1, ids)
+		msg.packedField(2, []uint64{uint64(s.count), uint64(s.count * int64(p.period))})
+		profile.messageField(2, &msg) // sample
+	}
+
+	var mapping protoBuffer
+	mapping.uint64Field(1, 1)
+	mapping.uint64Field(3, 0x10000) // memory_limit
+	mapping.int64Field(5, str(romName))
+	mapping.boolField(7, true) // has_functions
+	mapping.boolField(8, syms != nil)
+	mapping.boolField(9, syms != nil)
+	profile.messageField(3, &mapping)
+
+	for _, loc := range locationMsgs {
+		profile.messageField(4, loc)
+	}
+	for _, fn := range functionMsgs {
+		profile.messageField(5, fn)
+	}
+
+	profile.int64Field(9, p.start.UnixNano())
+	profile.int64Field(10, int64(time.Since(p.start)))
+	var periodType protoBuffer
+	periodType.int64Field(1, str("cpu"))
+	periodType.int64Field(2, str("nanoseconds"))
+	profile.messageField(11, &periodType)
+	profile.int64Field(12, int64(p.period))
+	profile.int64Field(14, str("instructions")) // default_sample_type
+	for _, s := range stringTable {
+		profile.stringField(6, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (p *Profiler) WriteFile(filename, romName string, syms *symbols.Map) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := p.Write(file, romName, syms); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,267 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/symbols"
+)
+
+// run executes rom with the emulator's instruction handlers for the given
+// number of steps, reporting every instruction to p.
+func run(p *Profiler, rom []byte, steps int) {
+	state := emulator.InitChipState()
+	copy(state.Memory[emulator.INITIAL_PC:], rom)
+	for i := 0; i < steps; i++ {
+		instruction := emulator.FetchInstruction(state.Memory, state.PC)
+		p.BeforeExecute(state, instruction)
+		state.PC += 2
+		switch instruction >> 12 {
+		case 0x0:
+			emulator.Op0(state, instruction)
+		case 0x1:
+			emulator.Op1(state, instruction)
+		case 0x2:
+			emulator.Op2(state, instruction)
+		case 0x6:
+			emulator.Op6(state, instruction)
+		}
+	}
+}
+
+// field is a decoded protocol buffer field, either a varint or bytes.
+type field struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+func readVarint(t *testing.T, data []byte) (uint64, []byte) {
+	var v uint64
+	for shift := uint(0); len(data) > 0; shift += 7 {
+		b := data[0]
+		data = data[1:]
+		v |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return v, data
+		}
+	}
+	t.Fatal("truncated varint")
+	return 0, nil
+}
+
+func readFields(t *testing.T, data []byte) []field {
+	var fields []field
+	for len(data) > 0 {
+		var key uint64
+		key, data = readVarint(t, data)
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.varint, data = readVarint(t, data)
+		case wireBytes:
+			var n uint64
+			n, data = readVarint(t, data)
+			if n > uint64(len(data)) {
+				t.Fatalf("field %d of %d bytes runs past the message", f.num, n)
+			}
+			f.bytes, data = data[:n], data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func readPacked(t *testing.T, data []byte) []uint64 {
+	var vs []uint64
+	for len(data) > 0 {
+		var v uint64
+		v, data = readVarint(t, data)
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+// decodedProfile holds the parts of a profile.proto message the tests check.
+type decodedProfile struct {
+	strings []string
+	// samples maps a stack, written innermost first as function@address
+	// [source line], to its values
+	samples map[string][]uint64
+	period  uint64
+}
+
+func decode(t *testing.T, data []byte) *decodedProfile {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type location struct {
+		address, function, line uint64
+	}
+	profile := &decodedProfile{samples: make(map[string][]uint64)}
+	var samples [][]field
+	locations := make(map[uint64]location)
+	functions := make(map[uint64]uint64) // id to name
+	for _, f := range readFields(t, raw) {
+		switch f.num {
+		case 2:
+			samples = append(samples, readFields(t, f.bytes))
+		case 4:
+			var id uint64
+			var loc location
+			for _, lf := range readFields(t, f.bytes) {
+				switch lf.num {
+				case 1:
+					id = lf.varint
+				case 3:
+					loc.address = lf.varint
+				case 4:
+					for _, line := range readFields(t, lf.bytes) {
+						switch line.num {
+						case 1:
+							loc.function = line.varint
+						case 2:
+							loc.line = line.varint
+						}
+					}
+				}
+			}
+			locations[id] = loc
+		case 5:
+			var id, name uint64
+			for _, ff := range readFields(t, f.bytes) {
+				switch ff.num {
+				case 1:
+					id = ff.varint
+				case 2:
+					name = ff.varint
+				}
+			}
+			functions[id] = name
+		case 6:
+			profile.strings = append(profile.strings, string(f.bytes))
+		case 12:
+			profile.period = f.varint
+		}
+	}
+
+	for _, sample := range samples {
+		var stack []string
+		var values []uint64
+		for _, f := range sample {
+			switch f.num {
+			case 1:
+				for _, id := range readPacked(t, f.bytes) {
+					loc, ok := locations[id]
+					if !ok {
+						t.Fatalf("sample refers to missing location %d", id)
+					}
+					frame := fmt.Sprintf("%s@0x%03X", profile.strings[functions[loc.function]], loc.address)
+					if loc.line != 0 {
+						frame += fmt.Sprintf(":%d", loc.line)
+					}
+					stack = append(stack, frame)
+				}
+			case 2:
+				values = readPacked(t, f.bytes)
+			}
+		}
+		profile.samples[strings.Join(stack, " ")] = values
+	}
+	return profile
+}
+
+// callTwice calls a subroutine twice, then loops forever.
+var callTwice = []byte{
+	0x22, 0x06, // 0x200 CALL 0x206
+	0x22, 0x06, // 0x202 CALL 0x206
+	0x12, 0x04, // 0x204 JP 0x204
+	0x60, 0x01, // 0x206 LD V0, 1
+	0x00, 0xEE, // 0x208 RET
+}
+
+func TestProfile(t *testing.T) {
+	const period = time.Millisecond
+	p := New().SetPeriod(period)
+	run(p, callTwice, 10)
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf, "test.ch8", nil); err != nil {
+		t.Fatal(err)
+	}
+	profile := decode(t, buf.Bytes())
+
+	if len(profile.strings) == 0 || profile.strings[0] != "" {
+		t.Errorf("string table %q does not start with the empty string", profile.strings)
+	}
+	if profile.period != uint64(period) {
+		t.Errorf("period %d, want %d", profile.period, period)
+	}
+
+	counts := map[string]uint64{
+		"main@0x200":               1,
+		"sub_206@0x206 main@0x200": 1,
+		"sub_206@0x208 main@0x200": 1,
+		"main@0x202":               1,
+		"sub_206@0x206 main@0x202": 1,
+		"sub_206@0x208 main@0x202": 1,
+		"main@0x204":               4,
+	}
+	want := make(map[string][]uint64)
+	for stack, count := range counts {
+		want[stack] = []uint64{count, count * uint64(period)}
+	}
+	if !reflect.DeepEqual(profile.samples, want) {
+		t.Errorf("samples\n%v\nwant\n%v", profile.samples, want)
+	}
+}
+
+func TestProfileSymbols(t *testing.T) {
+	syms := &symbols.Map{}
+	syms.AddLabel("draw", 0x206)
+	for i, addr := range []uint16{0x200, 0x202, 0x204, 0x206, 0x208} {
+		syms.AddLine(addr, 2, "test.s", i+1)
+	}
+
+	p := New()
+	run(p, callTwice, 3)
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf, "test.ch8", syms); err != nil {
+		t.Fatal(err)
+	}
+	profile := decode(t, buf.Bytes())
+
+	var stacks []string
+	for stack := range profile.samples {
+		stacks = append(stacks, stack)
+	}
+	want := map[string]bool{
+		"main@0x200:1":              true,
+		"draw@0x206:4 main@0x200:1": true,
+		"draw@0x208:5 main@0x200:1": true,
+	}
+	if len(stacks) != len(want) {
+		t.Fatalf("stacks %q, want %d", stacks, len(want))
+	}
+	for _, stack := range stacks {
+		if !want[stack] {
+			t.Errorf("unexpected stack %q", stack)
+		}
+	}
+}
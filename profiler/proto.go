@@ -0,0 +1,69 @@
+package profiler
+
+import (
+	"bytes"
+)
+
+// protoBuffer encodes the protocol buffer wire format, just enough of it to
+// write profile.proto messages without depending on a protobuf library.
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64Field writes a scalar field, leaving out zero like proto3 does.
+func (b *protoBuffer) uint64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int64Field(field int, v int64) {
+	b.uint64Field(field, uint64(v))
+}
+
+func (b *protoBuffer) boolField(field int, v bool) {
+	if v {
+		b.uint64Field(field, 1)
+	}
+}
+
+// stringField always writes the string, as the empty first entry of the
+// string table has to be present.
+func (b *protoBuffer) stringField(field int, s string) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(s)))
+	b.WriteString(s)
+}
+
+func (b *protoBuffer) messageField(field int, m *protoBuffer) {
+	b.key(field, wireBytes)
+	b.varint(uint64(m.Len()))
+	b.Write(m.Bytes())
+}
+
+func (b *protoBuffer) packedField(field int, vs []uint64) {
+	var packed protoBuffer
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	b.messageField(field, &packed)
+}
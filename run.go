@@ -1,18 +1,142 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kopi22/chip8/config"
+	"github.com/kopi22/chip8/coverage"
 	"github.com/kopi22/chip8/emulator"
+	"github.com/kopi22/chip8/emulator/io"
 	"github.com/kopi22/chip8/emulator/io/tcellIO"
+	"github.com/kopi22/chip8/profiler"
 )
 
 // TODO:
 // - add sound support
-// - add scaling support
 // - fix first key press issue
 
 func main() {
+	watch := flag.Bool("watch", false, "reload the ROM or Octo source whenever the file changes")
+	stateFile := flag.String("state", "", "save state for F5/F9, restored after every reload when set")
+	profile := flag.String("profile", "", "write a pprof profile of the executed instructions on exit")
+	coverageFile := flag.String("coverage", "", "record the executed instructions, adding to this coverage file on exit")
+	renderMode := flag.String("render", string(tcellIO.RenderAuto), "how pixels are drawn: auto, double, halfblock, braille or ascii")
+	configFile := flag.String("config", "", "config file, by default chip8/config.json in the user config directory")
+	paletteName := flag.String("palette", "", "palette to start with, unless the ROM brings its own colours; F2 cycles through them")
+	phosphor := flag.Float64("phosphor", 0, "reduce flicker by fading pixels out, keeping this fraction of their brightness each frame, e.g. 0.6")
+	hold := flag.Int("hold", 0, "reduce flicker by keeping pixels lit until they have been off for this many frames")
+	debug := flag.Bool("debug", false, "start paused with the debugger shown: F6 runs and pauses, F7 steps, F8 sets a breakpoint, F12 hides it")
+	keypad := flag.Bool("keypad", false, "show the keypad beside the display, with the keyboard keys of each key; keys can be clicked, F11 hides it")
+	statusBar := flag.Bool("status", false, "show the ROM title, measured instructions and frames per second, speed and quirks below the display")
+	shotScale := flag.Int("shotscale", emulator.DefaultScreenshotScale, "size in image pixels of every display pixel in the screenshots F3 saves next to the ROM")
+	shotPaletteName := flag.String("shotpalette", "", "palette of screenshots, by default the one of the display")
+	record := flag.String("record", "", "record the display from the start to this .gif or .y4m file; F4 stops and starts recording")
+	recordFormat := flag.String("recordformat", "gif", "format of the recordings F4 saves next to the ROM: gif or y4m")
+	flag.Parse()
+
+	mode, err := tcellIO.ParseRenderMode(*renderMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	settings, err := config.LoadOrDefault(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	palettes, err := settings.AllPalettes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *paletteName == "" {
+		*paletteName = settings.Palette
+	}
+	if _, ok := io.FindPalette(palettes, *paletteName); *paletteName != "" && !ok {
+		fmt.Fprintf(os.Stderr, "unknown palette %q\n", *paletteName)
+		os.Exit(2)
+	}
+
+	shotPalette, ok := io.FindPalette(palettes, *shotPaletteName)
+	if *shotPaletteName != "" && !ok {
+		fmt.Fprintf(os.Stderr, "unknown palette %q\n", *shotPaletteName)
+		os.Exit(2)
+	}
+
+	recordingExtension := "." + *recordFormat
+	if recordingExtension != emulator.GIFExtension && recordingExtension != emulator.Y4MExtension {
+		fmt.Fprintf(os.Stderr, "unknown recording format %q\n", *recordFormat)
+		os.Exit(2)
+	}
+
+	romFilename := "Pong1.ch8"
+	if flag.NArg() > 0 {
+		romFilename = flag.Arg(0)
+	}
+
 	// set up emulator
-	emu := emulator.NewEmulator().ConnectIO(new(tcellIO.IO))
+	display := new(tcellIO.IO)
+	display.SetRenderMode(mode)
+	display.SetDebugger(*debug)
+	display.SetKeypad(*keypad)
+	display.SetStatusBar(*statusBar)
+	switch {
+	case *phosphor > 0 && *phosphor < 1:
+		display.SetPhosphor(io.NewPhosphorDecay(*phosphor))
+	case *phosphor != 0:
+		fmt.Fprintln(os.Stderr, "-phosphor must be between 0 and 1")
+		os.Exit(2)
+	case *hold > 0:
+		display.SetPhosphor(io.NewPhosphorHold(*hold))
+	}
+	emu := emulator.NewEmulator().
+		SetHotReload(*watch).
+		SetStateFile(*stateFile).
+		SetPalettes(palettes).
+		SetScreenshotScale(*shotScale).
+		SetScreenshotPalette(shotPalette).
+		SetRecordingFormat(recordingExtension).
+		SetPaused(*debug)
+	if *record != "" {
+		if err := emu.StartRecording(*record); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	emu.ConnectIO(display)
+
+	if *paletteName != "" {
+		emu.SelectPalette(*paletteName)
+	}
+
+	if *profile != "" {
+		prof := profiler.New()
+		emu.AddObserver(prof).AtExit(func() {
+			prof.SetPeriod(emu.CPUPeriod())
+			if err := prof.WriteFile(*profile, romFilename, emu.Symbols()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		})
+	}
+
+	if *coverageFile != "" {
+		cov := coverage.New()
+		emu.AddObserver(cov).AtExit(func() {
+			// runs add up in the same file
+			if previous, err := coverage.ReadFile(*coverageFile); err == nil {
+				cov.Merge(previous)
+			} else if !os.IsNotExist(err) {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+			if err := cov.WriteFile(*coverageFile); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		})
+	}
 
-	emu.Launch("Pong1.ch8")
+	emu.Launch(romFilename)
 }
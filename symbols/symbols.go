@@ -0,0 +1,307 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Extension replaces the extension of a ROM to name its symbol map.
+const Extension = ".sym"
+
+// Symbol names an address of a program.
+type Symbol struct {
+	Name    string
+	Address uint16
+}
+
+// Line is the source line the Size bytes at Address were assembled from.
+type Line struct {
+	Address uint16
+	Size    int
+	File    string
+	Line    int
+}
+
+func (l Line) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Region is a range of addresses holding data rather than code.
+type Region struct {
+	Address uint16
+	Size    int
+}
+
+// Map is the symbol file written next to an assembled ROM, linking addresses
+// to labels, source lines and data. Each line holds a record kind followed by
+// its fields:
+//
+//	label 0x200 main
+//	line 0x200 2 12 game.s
+//	data 0x2F0 16
+type Map struct {
+	Labels []Symbol
+	Lines  []Line
+	Data   []Region
+}
+
+func (m *Map) AddLabel(name string, addr uint16) {
+	m.Labels = append(m.Labels, Symbol{Name: name, Address: addr})
+}
+
+// AddLine records the source line of the size bytes at addr.
+func (m *Map) AddLine(addr uint16, size int, file string, line int) {
+	m.Lines = append(m.Lines, Line{Address: addr, Size: size, File: file, Line: line})
+}
+
+// AddData marks size bytes from addr as data, extending the last region when
+// it ends at addr.
+func (m *Map) AddData(addr uint16, size int) {
+	if size <= 0 {
+		return
+	}
+	if n := len(m.Data); n > 0 && int(m.Data[n-1].Address)+m.Data[n-1].Size == int(addr) {
+		m.Data[n-1].Size += size
+		return
+	}
+	m.Data = append(m.Data, Region{Address: addr, Size: size})
+}
+
+// Label returns the name of the label at addr.
+func (m *Map) Label(addr uint16) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	for _, label := range m.Labels {
+		if label.Address == addr {
+			return label.Name, true
+		}
+	}
+	return "", false
+}
+
+// Enclosing returns the closest label at or below addr, which for code is
+// usually the routine the address belongs to.
+func (m *Map) Enclosing(addr uint16) (Symbol, bool) {
+	var best Symbol
+	found := false
+	if m == nil {
+		return best, false
+	}
+	for _, label := range m.Labels {
+		if label.Address <= addr && (!found || label.Address > best.Address) {
+			best, found = label, true
+		}
+	}
+	return best, found
+}
+
+// Source returns the source line the byte at addr was assembled from.
+func (m *Map) Source(addr uint16) (Line, bool) {
+	if m == nil {
+		return Line{}, false
+	}
+	for _, line := range m.Lines {
+		if addr >= line.Address && int(addr) < int(line.Address)+line.Size {
+			return line, true
+		}
+	}
+	return Line{}, false
+}
+
+// IsData reports whether addr lies in a data region.
+func (m *Map) IsData(addr uint16) bool {
+	if m == nil {
+		return false
+	}
+	for _, region := range m.Data {
+		if addr >= region.Address && int(addr) < int(region.Address)+region.Size {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeAddresses returns the addresses of the source lines outside of data
+// regions, which are the instructions of the program.
+func (m *Map) CodeAddresses() []uint16 {
+	if m == nil {
+		return nil
+	}
+	var addrs []uint16
+	for _, line := range m.Lines {
+		if !m.IsData(line.Address) {
+			addrs = append(addrs, line.Address)
+		}
+	}
+	return addrs
+}
+
+// Describe names addr for people: the enclosing label with an offset and the
+// source line when they are known, e.g. "draw+0x4 (game.s:31)".
+func (m *Map) Describe(addr uint16) string {
+	desc := fmt.Sprintf("0x%03X", addr)
+	if label, ok := m.Enclosing(addr); ok {
+		desc = label.Name
+		if offset := addr - label.Address; offset > 0 {
+			desc += fmt.Sprintf("+0x%X", offset)
+		}
+	}
+	if line, ok := m.Source(addr); ok {
+		desc += " (" + line.String() + ")"
+	}
+	return desc
+}
+
+func (m *Map) sort() {
+	sort.SliceStable(m.Labels, func(i, j int) bool {
+		return m.Labels[i].Address < m.Labels[j].Address
+	})
+	sort.SliceStable(m.Lines, func(i, j int) bool {
+		return m.Lines[i].Address < m.Lines[j].Address
+	})
+	sort.SliceStable(m.Data, func(i, j int) bool {
+		return m.Data[i].Address < m.Data[j].Address
+	})
+}
+
+func (m *Map) Write(w io.Writer) error {
+	m.sort()
+	out := bufio.NewWriter(w)
+	for _, label := range m.Labels {
+		fmt.Fprintf(out, "label 0x%03X %s\n", label.Address, label.Name)
+	}
+	for _, region := range m.Data {
+		fmt.Fprintf(out, "data 0x%03X %d\n", region.Address, region.Size)
+	}
+	for _, line := range m.Lines {
+		fmt.Fprintf(out, "line 0x%03X %d %d %s\n", line.Address, line.Size, line.Line, line.File)
+	}
+	return out.Flush()
+}
+
+func (m *Map) WriteFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := m.Write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Read parses a symbol file. Unknown record kinds are skipped so that older
+// readers accept newer files.
+func Read(r io.Reader) (*Map, error) {
+	m := &Map{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "label":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected 'label ADDRESS NAME'", lineNo)
+			}
+			addr, err := parseAddress(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			m.AddLabel(fields[2], addr)
+		case "line":
+			if len(fields) < 5 {
+				return nil, fmt.Errorf("line %d: expected 'line ADDRESS SIZE LINE FILE'", lineNo)
+			}
+			addr, err := parseAddress(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			size, err1 := strconv.Atoi(fields[2])
+			line, err2 := strconv.Atoi(fields[3])
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("line %d: invalid size or line number", lineNo)
+			}
+			// the file name is the rest of the line and may hold spaces
+			m.AddLine(addr, size, afterFields(scanner.Text(), 4), line)
+		case "data":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected 'data ADDRESS SIZE'", lineNo)
+			}
+			addr, err := parseAddress(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			size, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid size %q", lineNo, fields[2])
+			}
+			m.Data = append(m.Data, Region{Address: addr, Size: size})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	m.sort()
+	return m, nil
+}
+
+func ReadFile(filename string) (*Map, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// ReadForROM reads the named symbol map, or the one next to the ROM if no
+// name is given and there is one. Without a symbol map the result is nil.
+func ReadForROM(filename, romFilename string) (*Map, error) {
+	if filename != "" {
+		return ReadFile(filename)
+	}
+
+	filename = strings.TrimSuffix(romFilename, filepath.Ext(romFilename)) + Extension
+	syms, err := ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return syms, err
+}
+
+// afterFields returns what follows the first n fields of s, without the
+// surrounding space.
+func afterFields(s string, n int) string {
+	for i := 0; i < n; i++ {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		s = s[end:]
+	}
+	return strings.TrimSpace(s)
+}
+
+func parseAddress(s string) (uint16, error) {
+	addr, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return uint16(addr), nil
+}
@@ -0,0 +1,74 @@
+package symbols
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	input := "# written by hand\n" +
+		"label 0x200 main\n" +
+		"label\t0x206\tdraw\n" +
+		"data  0x20A   4\n" +
+		"line 0x200 2 1 game.s\n" +
+		"line\t0x202\t2\t2\tgame.s\n" +
+		"line   0x204  2   3   my game.s  \n" +
+		"unknown 0x200\n"
+
+	m, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Map{
+		Labels: []Symbol{{"main", 0x200}, {"draw", 0x206}},
+		Lines: []Line{
+			{Address: 0x200, Size: 2, File: "game.s", Line: 1},
+			{Address: 0x202, Size: 2, File: "game.s", Line: 2},
+			{Address: 0x204, Size: 2, File: "my game.s", Line: 3},
+		},
+		Data: []Region{{Address: 0x20A, Size: 4}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("read %+v, want %+v", m, want)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	m := &Map{}
+	m.AddLabel("main", 0x200)
+	m.AddLine(0x200, 2, "my game.s", 4)
+	m.AddLine(0x202, 3, "data.s", 10)
+	m.AddData(0x202, 3)
+
+	var out strings.Builder
+	if err := m.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, m) {
+		t.Errorf("read back %+v, want %+v", read, m)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"label 0x200\n", "line 1: expected 'label ADDRESS NAME'"},
+		{"line 0x200 2 1\n", "line 1: expected 'line ADDRESS SIZE LINE FILE'"},
+		{"line 0x200 two 1 game.s\n", "line 1: invalid size or line number"},
+		{"label main 0x200\n", `line 1: invalid address "main"`},
+	}
+
+	for _, test := range tests {
+		if _, err := Read(strings.NewReader(test.input)); err == nil || err.Error() != test.err {
+			t.Errorf("%q: error %v, want %s", test.input, err, test.err)
+		}
+	}
+}